@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	"github.com/pronei/nogo/internal/helpers"
+	"github.com/pronei/nogo/internal/store"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// ResetState clears the state of an entity, or only of the attributes listed in the change, so that its
+// limits start over. The change is recorded in the audit log.
+func (rl *rateLimiter) ResetState(ctx context.Context, change *structs.StateChange) error {
+	if err := checkStateChange(change); err != nil {
+		return fmt.Errorf("Failed to reset state - %w\n", err)
+	}
+	entityKey := helpers.FormKey(change.EntityType, change.EntityName)
+	if err := rl.stateStore.ClearState(ctx, entityKey, change.Attributes); err != nil {
+		return fmt.Errorf("Failed to reset state - %w\n", err)
+	}
+	rl.audit(ctx, change, enums.AdminStateReset)
+	return nil
+}
+
+// GrantCredits gives an entity one-off credits and returns how many it has. A request its limits would
+// deny uses a credit instead, see structs.Decision. The change is recorded in the audit log.
+// Credits apply to requests evaluated one unit at a time (Allowed, AllowAndUpdate, Evaluate, EvaluateAndUpdate,
+// AllowAndUpdateBatch and Inspect), AllowUpTo and Reserve grant units by the limits alone.
+func (rl *rateLimiter) GrantCredits(ctx context.Context, change *structs.StateChange) (int64, error) {
+	if err := checkStateChange(change); err != nil {
+		return 0, fmt.Errorf("Failed to grant credits - %w\n", err)
+	}
+	if change.Credits <= 0 {
+		return 0, fmt.Errorf("Failed to grant credits - credits must be positive, got %d\n", change.Credits)
+	}
+	balance, err := rl.stateStore.AddCredits(ctx, helpers.FormKey(change.EntityType, change.EntityName), change.Credits)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to grant credits - %w\n", err)
+	}
+	rl.audit(ctx, change, enums.AdminCreditGrant)
+	return balance, nil
+}
+
+// GetCredits returns the credits an entity has left
+func (rl *rateLimiter) GetCredits(ctx context.Context, entityType, entityName string) (int64, error) {
+	entityKey := helpers.FormKey(entityType, entityName)
+	credits, err := rl.stateStore.GetCredits(ctx, []string{entityKey})
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get credits - %w\n", err)
+	}
+	return credits[entityKey], nil
+}
+
+// AuditLog returns up to limit of the latest administrative changes, newest first. The latest
+// constants.AuditLogSize changes are kept.
+func (rl *rateLimiter) AuditLog(ctx context.Context, limit int) ([]structs.AuditEntry, error) {
+	if limit <= 0 || limit > constants.AuditLogSize {
+		limit = constants.AuditLogSize
+	}
+	entries, err := rl.stateStore.GetAudit(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get audit log - %w\n", err)
+	}
+	return entries, nil
+}
+
+func checkStateChange(change *structs.StateChange) error {
+	switch {
+	case change == nil:
+		return fmt.Errorf("change is missing")
+	case change.EntityType == "" || change.EntityName == "":
+		return fmt.Errorf("entity type and name are required")
+	case change.Actor == "":
+		return fmt.Errorf("actor is required for the audit log")
+	}
+	return nil
+}
+
+// audit records a change that was made in the audit log and the logger, a change that cannot be
+// recorded is still made as it cannot be taken back
+func (rl *rateLimiter) audit(ctx context.Context, change *structs.StateChange, action enums.AdminAction) {
+	entry := &structs.AuditEntry{StateChange: *change, Action: action, At: time.Now()}
+	rl.logger.Info("%s by %s for %s:%s - attributes %v, credits %d, reason %q\n", string(action), change.Actor,
+		change.EntityType, change.EntityName, change.Attributes, change.Credits, change.Reason)
+	if err := rl.stateStore.AppendAudit(ctx, entry); err != nil {
+		rl.logger.Error("cannot record %s by %s in the audit log - %s\n", string(action), change.Actor, err.Error())
+	}
+}
+
+// returnCredits gives back a credit to each of the entities, for requests that used one but whose state
+// could not be stored
+func (rl *rateLimiter) returnCredits(ctx context.Context, entityKeys []string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, entityKey := range entityKeys {
+		if _, err := rl.stateStore.AddCredits(ctx, entityKey, 1); err != nil {
+			rl.logger.Error("cannot give back the credit used by %s - %s\n", entityKey, err.Error())
+		}
+	}
+}
+
+// useCredits lets a denied request through when every entity whose enforced rules deny it has a credit,
+// a credit of each of them is only taken when the state is updated. The rules of the other entities are
+// returned to be consumed as usual, all of the rules when the request stays denied.
+func (rl *rateLimiter) useCredits(ctx context.Context, enforced map[string]structs.EntityRules, stateMap store.StateMap,
+	update bool, decision *structs.Decision) (map[string]structs.EntityRules, error) {
+
+	var denying []string
+	passing := make(map[string]structs.EntityRules)
+	for entityKey, entity := range enforced {
+		pass, err := rl.checker.Allowed(map[string]structs.EntityRules{entityKey: entity}, stateMap)
+		if err != nil {
+			return nil, fmt.Errorf("strategy: pass check failure - %w\n", err)
+		}
+		if pass {
+			passing[entityKey] = entity
+		} else {
+			denying = append(denying, entityKey)
+		}
+	}
+	if len(denying) == 0 {
+		return enforced, nil
+	}
+	sort.Strings(denying)
+
+	var credited bool
+	if update {
+		var err error
+		if credited, err = rl.stateStore.UseCredits(ctx, denying); err != nil {
+			return nil, fmt.Errorf("failed to use credits - %w\n", err)
+		}
+	} else {
+		credits, err := rl.stateStore.GetCredits(ctx, denying)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve credits - %w\n", err)
+		}
+		credited = len(credits) == len(denying)
+	}
+	if !credited {
+		return enforced, nil
+	}
+	decision.Allowed, decision.Credited = true, denying
+	return passing, nil
+}
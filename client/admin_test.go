@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pronei/nogo/internal/store"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// failingStore fails every write of the state
+type failingStore struct {
+	store.StateStore
+}
+
+func (failingStore) SetState(context.Context, store.StateMap) error {
+	return errors.New("store is down")
+}
+
+func TestCredits(t *testing.T) {
+	rule := structs.AttributeRule{AttributeType: "tier", AttributeValue: "free", Rates: []structs.Rate{{Duration: 3600, Limit: 1}}}
+	rl := testLimiter(t, "rolling_window", rule)
+	ctx := context.Background()
+	request := userRequest("u1", map[string]string{"tier": "free"})
+
+	if _, err := rl.GrantCredits(ctx, &structs.StateChange{EntityType: "user", EntityName: "u1", Credits: 1, Actor: "support"}); err != nil {
+		t.Fatalf("could not grant credits - %v", err)
+	}
+	if decision, err := rl.EvaluateAndUpdate(ctx, request); err != nil || !decision.Allowed || len(decision.Credited) > 0 {
+		t.Fatalf("first request should be allowed by the limit, decision = %+v, err = %v", decision, err)
+	}
+
+	inspection, err := rl.Inspect(ctx, request)
+	if err != nil {
+		t.Fatalf("inspection failed - %v", err)
+	}
+	if !inspection.Allowed || len(inspection.Credited) != 1 {
+		t.Errorf("inspection should allow the request with a credit, got %+v", inspection.Decision)
+	}
+
+	// a credit used by a request whose state cannot be stored is given back, u2 is within its limit
+	// and has its state updated along with the request
+	both := userRequest("u1", map[string]string{"tier": "free"})
+	both.Parameters["u2"] = structs.EntityParameters{EntityType: "user", AttributesMap: map[string]string{"tier": "free"}}
+	working := rl.stateStore
+	rl.stateStore = failingStore{working}
+	if _, err := rl.EvaluateAndUpdate(ctx, both); err == nil {
+		t.Fatal("evaluation should fail when the state cannot be stored")
+	}
+	rl.stateStore = working
+	if credits, _ := rl.GetCredits(ctx, "user", "u1"); credits != 1 {
+		t.Fatalf("credits = %d after a failed evaluation, want 1", credits)
+	}
+
+	for i, want := range []bool{true, false} {
+		decision, err := rl.EvaluateAndUpdate(ctx, request)
+		if err != nil {
+			t.Fatalf("evaluation failed - %v", err)
+		}
+		if decision.Allowed != want {
+			t.Errorf("request %d over the limit: allowed = %v, want %v", i+1, decision.Allowed, want)
+		}
+	}
+	if credits, _ := rl.GetCredits(ctx, "user", "u1"); credits != 0 {
+		t.Errorf("credits = %d, want 0", credits)
+	}
+}
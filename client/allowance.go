@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	structs "github.com/pronei/nogo/shared"
+)
+
+// AllowUpTo grants as many of the n units of the request as all its rules allow, each unit counting like a
+// request of its own, and consumes them in a single update of the state. The units that were not granted are
+// reported as the backlog along with how long it takes until more can be granted, or that none ever will be.
+// Shadow rules are reported like for AllowAndUpdate, also when no units are granted.
+// Like AllowAndUpdate, the state is read and written back in separate round-trips to the store, so granting
+// the units is not atomic: concurrent calls for the same entity can be granted the same units, the last write wins.
+func (rl *rateLimiter) AllowUpTo(ctx context.Context, request *structs.LimitRequest, n int64) (*structs.Allowance, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("cannot allow %d units, asking for at least one is required\n", n)
+	}
+	loaded, err := rl.load(ctx, []*structs.LimitRequest{request})
+	if err != nil {
+		return nil, err
+	}
+
+	if decision := loaded.decisions[0]; decision != nil {
+		allowance := &structs.Allowance{Decision: *decision, Backlog: n}
+		if decision.Allowed {
+			allowance.Granted, allowance.Backlog = n, 0
+		} else if decision.Block != nil && decision.Block.ExpiresAt != nil {
+			allowance.RetryAfter = time.Until(*decision.Block.ExpiresAt)
+		} else if decision.Block != nil {
+			allowance.Never = true
+		}
+		return allowance, nil
+	}
+
+	enforced, shadow := splitShadow(loaded.rules[0], rl.shadow)
+	granted, wait, err := rl.checker.Grantable(enforced, loaded.state, n)
+	if err != nil {
+		return nil, fmt.Errorf("strategy: grant check failure - %w\n", err)
+	}
+	allowance := &structs.Allowance{Granted: granted, Backlog: n - granted}
+	allowance.Allowed = granted > 0
+	if granted < n && wait >= 0 {
+		allowance.RetryAfter = time.Duration(wait) * rl.unit
+	} else if granted < n {
+		allowance.Never = true
+	}
+	if granted == 0 {
+		// nothing is consumed, the shadow rules still report whether they would have granted none either
+		if _, err := rl.checkShadow(shadow, &allowance.Decision, func(single map[string]structs.EntityRules) (bool, error) {
+			shadowGranted, _, err := rl.checker.Grantable(single, loaded.state, n)
+			return shadowGranted > 0, err
+		}); err != nil {
+			return nil, err
+		}
+		rl.reportShadow(ctx, []*structs.LimitRequest{request}, []*structs.Decision{&allowance.Decision})
+		return allowance, nil
+	}
+
+	if err := rl.consumeUnits(ctx, loaded, enforced, shadow, granted, &allowance.Decision); err != nil {
+		return nil, err
+	}
+	rl.keepReceipts(ctx, []*structs.Decision{&allowance.Decision})
+	rl.reportShadow(ctx, []*structs.LimitRequest{request}, []*structs.Decision{&allowance.Decision})
+	return allowance, nil
+}
+
+// consumeUnits takes the units from the state of the enforced rules and of the shadow rules that allow as many, the
+// shadow rules that do not are reported in the decision. The state is stored and the receipt set on the decision,
+// it is up to the caller to keep the receipt if it can be refunded.
+func (rl *rateLimiter) consumeUnits(ctx context.Context, loaded *loaded, enforced, shadow map[string]structs.EntityRules,
+	units int64, decision *structs.Decision) error {
+
+	passedShadow, err := rl.checkShadow(shadow, decision, func(single map[string]structs.EntityRules) (bool, error) {
+		shadowGranted, _, err := rl.checker.Grantable(single, loaded.state, units)
+		return shadowGranted == units, err
+	})
+	if err != nil {
+		return err
+	}
+
+	consumed := mergeRules(enforced, passedShadow)
+	if decision.Receipt, err = rl.checker.Consume(consumed, loaded.state, units); err != nil {
+		return fmt.Errorf("strategy: update failure - %w\n", err)
+	}
+	if decision.Receipt.ID, err = newReceiptID(); err != nil {
+		return err
+	}
+	return rl.storeState(ctx, loaded.state, entityKeys(consumed))
+}
+
+// entityKeys is the set of entities in the rule map
+func entityKeys(ruleMap map[string]structs.EntityRules) map[string]struct{} {
+	keys := make(map[string]struct{}, len(ruleMap))
+	for entityKey := range ruleMap {
+		keys[entityKey] = struct{}{}
+	}
+	return keys
+}
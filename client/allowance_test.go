@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	structs "github.com/pronei/nogo/shared"
+)
+
+func TestAllowUpToReportsShadowRulesWhenNothingIsGranted(t *testing.T) {
+	enforced := structs.AttributeRule{AttributeType: "user_tier", AttributeValue: "free", Rates: []structs.Rate{{Duration: 60, Limit: 1}}}
+	shadow := structs.AttributeRule{AttributeType: "user_tier", AttributeValue: "free", Shadow: true, Rates: []structs.Rate{{Duration: 60, Limit: 1}}}
+	rl := testLimiter(t, "rolling_window", enforced, shadow)
+	var reported []*structs.Decision
+	rl.shadowHook = func(_ context.Context, _ *structs.LimitRequest, decision *structs.Decision) {
+		reported = append(reported, decision)
+	}
+	ctx := context.Background()
+	request := userRequest("u1", map[string]string{"user_tier": "free"})
+
+	allowance, err := rl.AllowUpTo(ctx, request, 1)
+	if err != nil || allowance.Granted != 1 || len(allowance.WouldDeny) != 0 {
+		t.Fatalf("first allowance = %+v, err = %v", allowance, err)
+	}
+
+	allowance, err = rl.AllowUpTo(ctx, request, 2)
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if allowance.Granted != 0 || allowance.Allowed {
+		t.Fatalf("granted %d units past the enforced limit", allowance.Granted)
+	}
+	if len(allowance.WouldDeny) != 1 || !allowance.WouldDeny[0].Rule.Shadow {
+		t.Errorf("would deny = %+v, want the shadow rule", allowance.WouldDeny)
+	}
+	if len(reported) != 1 {
+		t.Errorf("shadow hook called %d times, want once", len(reported))
+	}
+}
+
+func TestAllowUpToTellsWhenTheBacklogIsNeverGranted(t *testing.T) {
+	tests := []struct {
+		name        string
+		refill      int64
+		wantGranted int64
+		wantNever   bool
+	}{
+		{name: "bucket that refills", refill: 1, wantGranted: 1},
+		// buckets fill up through their refills, one that never refills is never filled either
+		{name: "bucket that never refills", refill: 0, wantNever: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := structs.AttributeRule{AttributeType: "tier", AttributeValue: "free",
+				Bucket: structs.Bucket{Duration: 60, Refill: tt.refill, Cost: 1, Maximum: 1}}
+			rl := testLimiter(t, "fixed_bucket", rule)
+
+			allowance, err := rl.AllowUpTo(context.Background(), userRequest("u1", map[string]string{"tier": "free"}), 2)
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+			if allowance.Granted != tt.wantGranted || allowance.Backlog != 2-tt.wantGranted {
+				t.Fatalf("granted %d with a backlog of %d, want %d granted", allowance.Granted, allowance.Backlog, tt.wantGranted)
+			}
+			if allowance.Never != tt.wantNever || (allowance.RetryAfter > 0) == tt.wantNever {
+				t.Errorf("never = %v, retry after = %v, want never %v", allowance.Never, allowance.RetryAfter, tt.wantNever)
+			}
+		})
+	}
+}
@@ -3,13 +3,18 @@ package client
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pronei/nogo/internal/cache"
+	"github.com/pronei/nogo/internal/constants"
 	"github.com/pronei/nogo/internal/enums"
 	"github.com/pronei/nogo/internal/helpers"
 	"github.com/pronei/nogo/internal/store"
 	"github.com/pronei/nogo/internal/strategy"
 	structs "github.com/pronei/nogo/shared"
+	"github.com/pronei/nogo/source"
 )
 
 type RateLimiter interface {
@@ -19,11 +24,100 @@ type RateLimiter interface {
 	GetRulesByKeys([]string) map[string]structs.EntityRules
 }
 
+// Every rate limiter created implements the interfaces below along with RateLimiter,
+// they are reached by asserting the RateLimiter returned by Create or Get to them.
+
+// Evaluator explains its decisions and evaluates requests in batches or by the unit
+type Evaluator interface {
+	Evaluate(context.Context, *structs.LimitRequest) (*structs.Decision, error)
+	EvaluateAndUpdate(context.Context, *structs.LimitRequest) (*structs.Decision, error)
+	AllowAndUpdateBatch(context.Context, []*structs.LimitRequest) ([]*structs.Decision, error)
+	AllowUpTo(ctx context.Context, req *structs.LimitRequest, n int64) (*structs.Allowance, error)
+}
+
+// Refunder gives back what a request consumed by the receipt of its decision
+type Refunder interface {
+	Refund(ctx context.Context, req *structs.LimitRequest, receipt *structs.Receipt) (bool, error)
+}
+
+// Reserver holds an estimated cost of a request until it is settled with the actual cost
+type Reserver interface {
+	Reserve(ctx context.Context, req *structs.LimitRequest, estimate int64) (*structs.Reservation, error)
+	Settle(ctx context.Context, req *structs.LimitRequest, reservation *structs.Reservation, actual int64) (bool, error)
+}
+
+// Inspector shows how much of its limits a request has used
+type Inspector interface {
+	Inspect(context.Context, *structs.LimitRequest) (*structs.Inspection, error)
+	EvaluateAndInspect(context.Context, *structs.LimitRequest) (*structs.Inspection, error)
+}
+
+// RuleManager versions, checks, queries and syncs the rules in use
+type RuleManager interface {
+	ReplaceRules(*structs.RuleImport) (uint64, error)
+	RollbackRules(version uint64) (uint64, error)
+	RulesVersion() uint64
+	ValidateRules(*structs.RuleImport, enums.RuleAction) error
+	DiffRules(*structs.RuleImport) (*structs.RuleDiff, error)
+	DryRunRules(*structs.RuleImport, enums.RuleAction) (*structs.RuleDiff, error)
+	QueryRules(*structs.RuleQuery) (*structs.RuleQueryResult, error)
+	Subscribe(context.Context, source.RuleSource)
+}
+
+// Admin changes the state, credits and plans of single entities on behalf of support
+type Admin interface {
+	ResetState(context.Context, *structs.StateChange) error
+	GrantCredits(context.Context, *structs.StateChange) (int64, error)
+	GetCredits(ctx context.Context, entityType, entityName string) (int64, error)
+	AuditLog(ctx context.Context, limit int) ([]structs.AuditEntry, error)
+	AssignPlan(ctx context.Context, entityType, entityName, plan string) error
+	GetPlan(ctx context.Context, entityType, entityName string) (string, error)
+}
+
+// Closer stops the background work of a rate limiter, which it has to be closed for once its rules are
+// synced or it has made a reservation
+type Closer interface {
+	Close()
+}
+
+var (
+	_ RateLimiter = (*rateLimiter)(nil)
+	_ Evaluator   = (*rateLimiter)(nil)
+	_ Refunder    = (*rateLimiter)(nil)
+	_ Reserver    = (*rateLimiter)(nil)
+	_ Inspector   = (*rateLimiter)(nil)
+	_ RuleManager = (*rateLimiter)(nil)
+	_ Admin       = (*rateLimiter)(nil)
+	_ Closer      = (*rateLimiter)(nil)
+)
+
 type rateLimiter struct {
+	namespace  string
 	ruleCache  *cache.RuleCache
 	stateStore store.StateStore
 	checker    strategy.Limiter
 	logger     helpers.Logger
+
+	// time unit of the namespace, which rules and state are kept in
+	unit time.Duration
+	// reservations are held for this long unless they are settled
+	reservationTimeout time.Duration
+
+	// every rule is a shadow rule when the namespace is in shadow mode
+	shadow     bool
+	shadowHook structs.ShadowHook
+
+	// set when rules are shared with every instance of the namespace through Redis
+	ruleStore *store.RuleStore
+	ruleLock  sync.Mutex
+
+	// background work of the rate limiter stops once it is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+	// reservations are swept from the first one on
+	sweeping sync.Once
+	// when expired rules are next dropped, in unix nanoseconds, if the rules are not shared
+	nextCollect atomic.Int64
 }
 
 var registry map[string]RateLimiter
@@ -40,34 +134,80 @@ func Create(logger helpers.Logger, config *structs.RateLimiterConfig, importedRu
 		return nil, fmt.Errorf("Unable to create strategizer - %w\n", err)
 	}
 
+	switch config.Evaluation {
+	case "", enums.EvaluationAll, enums.EvaluationMostSpecific:
+	default:
+		return nil, fmt.Errorf("unknown rule evaluation mode %v", string(config.Evaluation))
+	}
+
 	var stateStore store.StateStore
+	var ruleStore *store.RuleStore
 	switch config.StorageType {
 	case enums.InMemoryStorage:
+		if config.SyncRules {
+			return nil, fmt.Errorf("rules can only be synced through redis storage")
+		}
 		stateStore = store.NewMemoryClient(logger, &config.InMemoryConfig)
 	case enums.RedisStorage:
-		if config.ExistingRedisClient != nil {
-			stateStore = store.FromRedisClient(logger, config.ExistingRedisClient, config.Namespace)
-		} else {
-			stateStore, err = store.NewRedisClient(logger, &config.RedisConfig, config.Namespace)
+		redisClient := config.ExistingRedisClient
+		if redisClient == nil {
+			redisClient, err = store.ConnectRedis(logger, &config.RedisConfig)
 			if err != nil {
 				return nil, fmt.Errorf("Unable to create state store - %w\n", err)
 			}
 		}
+		stateStore = store.FromRedisClient(logger, redisClient, config.Namespace)
+		if config.SyncRules {
+			ruleStore = store.NewRuleStore(redisClient, config.Namespace)
+		}
 	case enums.AerospikeStorage:
 		fallthrough
 	default:
 		return nil, fmt.Errorf("unable to find a suitable storage layer for %v", string(config.StorageType))
 	}
 
+	unit, err := helpers.GetTimeInDurationWithError(1, config.StrategyConfig.TimeUnit)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create strategizer - %w\n", err)
+	}
+
+	reservationTimeout := config.ReservationTimeout.ToStd()
+	if reservationTimeout <= 0 {
+		reservationTimeout = constants.DefaultReservationTimeout
+	}
+
 	rl := &rateLimiter{
-		ruleCache:  cache.New(),
+		namespace:  config.Namespace,
+		ruleCache:  cache.New(config),
 		stateStore: stateStore,
 		checker:    checker,
 		logger:     logger,
+		unit:       unit,
+		shadow:     config.Shadow,
+		shadowHook: config.ShadowHook,
+		ruleStore:  ruleStore,
+
+		reservationTimeout: reservationTimeout,
 	}
-	if err := rl.ruleCache.SaveRules(importedRules, enums.RuleAdd); err != nil {
+	rl.ctx, rl.cancel = context.WithCancel(context.Background())
+	if rl.ruleStore != nil {
+		// subscribe before loading so that no change is missed in between
+		updates, err := rl.ruleStore.Updates(rl.ctx)
+		if err != nil {
+			rl.cancel()
+			return nil, fmt.Errorf("Unable to sync rules - %w\n", err)
+		}
+		if err := rl.loadSharedRules(importedRules); err != nil {
+			rl.cancel()
+			return nil, fmt.Errorf("Unable to ingest rules - %w\n", err)
+		}
+		go rl.syncRules(rl.ctx, updates)
+		go rl.collectRules(rl.ctx)
+	} else if err := rl.ruleCache.SaveRules(importedRules, enums.RuleAdd); err != nil {
+		rl.cancel()
 		return nil, fmt.Errorf("Unable to ingest rules - %w\n", err)
 	}
+	rl.nextCollect.Store(time.Now().Add(constants.RuleCollectInterval).UnixNano())
 
 	registry[config.Namespace] = rl
 	return rl, nil
@@ -82,93 +222,333 @@ func Get(namespace string) (RateLimiter, error) {
 	return rl, nil
 }
 
+// Close stops syncing rules, dropping expired rules and sweeping reservations, and removes the rate
+// limiter from the registry. Rule sources passed to Subscribe are stopped through their own context.
+// It has to be called once the rate limiter is no longer used when its rules are synced or after it
+// has made a reservation, as their background work would keep running otherwise.
+func (rl *rateLimiter) Close() {
+	rl.cancel()
+	if registry[rl.namespace] == rl {
+		delete(registry, rl.namespace)
+	}
+}
+
 // Allowed checks if a request is deemed eligible to process as per the rules defined and the current state
 func (rl *rateLimiter) Allowed(ctx context.Context, request *structs.LimitRequest) (bool, error) {
+	decision, err := rl.evaluate(ctx, request, false)
+	if err != nil {
+		return false, err
+	}
+	return decision.Allowed, nil
+}
 
-	// NEW - ALL attribute is added for each entity in client request
-	AddAllAttributesForAllEntities(request)
-
-	// fetch valid rules for the given request from cache
-	rulesInCache := rl.ruleCache.GetValidRules(request)
-	if len(rulesInCache) == 0 {
-		rl.logger.Info("no rules found in cache for %v\n", request)
-		return true, nil
+func (rl *rateLimiter) AllowAndUpdate(ctx context.Context, request *structs.LimitRequest) (bool, error) {
+	decision, err := rl.evaluate(ctx, request, true)
+	if err != nil {
+		return false, err
 	}
+	return decision.Allowed, nil
+}
 
-	// create entity state request from cached rules
-	stateRequest := store.CreateStateRequest(rulesInCache)
+// AllowAndUpdateBatch works like AllowAndUpdate for every request in order, with one round-trip to the
+// state store for reading and one for writing. Requests sharing an entity see what the ones before them
+// consumed, and a decision is returned for every request at the same index.
+func (rl *rateLimiter) AllowAndUpdateBatch(ctx context.Context, requests []*structs.LimitRequest) ([]*structs.Decision, error) {
+	return rl.evaluateBatch(ctx, requests, true)
+}
 
-	// fetch the current state from backing store
-	stateMap, err := rl.stateStore.GetState(ctx, stateRequest)
-	//rl.logger.Info("state map snap - %#v\n", stateMap)
+// Evaluate works like Allowed and explains the outcome in a decision
+func (rl *rateLimiter) Evaluate(ctx context.Context, request *structs.LimitRequest) (*structs.Decision, error) {
+	return rl.evaluate(ctx, request, false)
+}
+
+// EvaluateAndUpdate works like AllowAndUpdate and explains the outcome in a decision
+func (rl *rateLimiter) EvaluateAndUpdate(ctx context.Context, request *structs.LimitRequest) (*structs.Decision, error) {
+	return rl.evaluate(ctx, request, true)
+}
+
+func (rl *rateLimiter) evaluate(ctx context.Context, request *structs.LimitRequest, update bool) (*structs.Decision, error) {
+	decisions, err := rl.evaluateBatch(ctx, []*structs.LimitRequest{request}, update)
 	if err != nil {
-		return false, fmt.Errorf("failed to retrieve state - %w\n", err)
+		return nil, err
 	}
+	return decisions[0], nil
+}
 
-	// check if the rules allow the current state to be updated
-	pass, err := rl.checker.Allowed(rulesInCache, stateMap)
+// evaluateBatch evaluates the requests in order against the state fetched for all of them at once, so that
+// requests sharing an entity see what the ones before them consumed. The state of every allowed request
+// is written back together, and not at all if any request fails to be evaluated.
+func (rl *rateLimiter) evaluateBatch(ctx context.Context, requests []*structs.LimitRequest, update bool) ([]*structs.Decision, error) {
+	loaded, err := rl.evaluateLoaded(ctx, requests, update)
 	if err != nil {
-		return false, fmt.Errorf("strategy: pass check failure - %w\n", err)
+		return nil, err
 	}
-	if !pass {
-		return false, nil
+	return loaded.decisions, nil
+}
+
+// evaluateLoaded works like evaluateBatch and returns the decisions along with the rules and the state they were made on
+func (rl *rateLimiter) evaluateLoaded(ctx context.Context, requests []*structs.LimitRequest, update bool) (_ *loaded, err error) {
+	loaded, err := rl.load(ctx, requests)
+	if err != nil {
+		return nil, err
 	}
 
-	return true, nil
+	// credits are taken as requests are evaluated and given back if their state is not stored in the end
+	var credited []string
+	defer func() {
+		if err != nil {
+			rl.returnCredits(ctx, credited)
+		}
+	}()
+
+	updated := make(map[string]struct{})
+	for i, rules := range loaded.rules {
+		if loaded.decisions[i] != nil {
+			continue
+		}
+
+		// check if the rules allow the current state to be updated, shadow rules only report if they would not
+		enforced, shadow := splitShadow(rules, rl.shadow)
+		decision := &structs.Decision{}
+		passedShadow, err := rl.checkShadow(shadow, decision, func(single map[string]structs.EntityRules) (bool, error) {
+			return rl.checker.Allowed(single, loaded.state)
+		})
+		if err != nil {
+			return nil, err
+		}
+		decision.Allowed, err = rl.checker.Allowed(enforced, loaded.state)
+		if err != nil {
+			return nil, fmt.Errorf("strategy: pass check failure - %w\n", err)
+		}
+		if !decision.Allowed {
+			if enforced, err = rl.useCredits(ctx, enforced, loaded.state, update, decision); err != nil {
+				return nil, err
+			}
+			if update {
+				credited = append(credited, decision.Credited...)
+			}
+		}
+
+		if decision.Allowed && update {
+			// change the state by incrementing counters/updating log windows depending upon the strategy
+			consumed := mergeRules(enforced, passedShadow)
+			if decision.Receipt, err = rl.checker.Consume(consumed, loaded.state, 1); err != nil {
+				return nil, fmt.Errorf("strategy: update failure - %w\n", err)
+			}
+			if decision.Receipt.ID, err = newReceiptID(); err != nil {
+				return nil, err
+			}
+			for entityKey := range consumed {
+				updated[entityKey] = struct{}{}
+			}
+		}
+		loaded.decisions[i] = decision
+	}
+
+	if err := rl.storeState(ctx, loaded.state, updated); err != nil {
+		return nil, err
+	}
+	rl.keepReceipts(ctx, loaded.decisions)
+	rl.reportShadow(ctx, requests, loaded.decisions)
+	return loaded, nil
 }
 
-func (rl *rateLimiter) AllowAndUpdate(ctx context.Context, request *structs.LimitRequest) (bool, error) {
+// loaded holds the requests of an evaluation with the rules that apply to each of them and their state
+type loaded struct {
+	// decisions are set for the requests that were decided without looking at any limits
+	decisions []*structs.Decision
+	rules     []map[string]structs.EntityRules
+	state     store.StateMap
+}
+
+// load finds the rules for each of the requests and reads the state of all of them in one go
+func (rl *rateLimiter) load(ctx context.Context, requests []*structs.LimitRequest) (*loaded, error) {
+	l := &loaded{
+		decisions: make([]*structs.Decision, len(requests)),
+		rules:     make([]map[string]structs.EntityRules, len(requests)),
+	}
+
+	// blocked and exempted requests skip the limits and the state store altogether
+	var checked []int
+	var planKeys []string
+	now := time.Now()
+	rl.collectLocally(now)
+	for i, request := range requests {
+		// NEW - ALL attribute is added for each entity in client request, before blocks and exemptions
+		// are matched so that they can apply to every request of an entity like limits do
+		AddAllAttributesForAllEntities(request)
 
-	// NEW - ALL attribute is added for each entity in client request
-	AddAllAttributesForAllEntities(request)
+		if block, blocked := rl.ruleCache.Block(request, now); blocked {
+			l.decisions[i] = &structs.Decision{Allowed: false, Block: block, Reason: block.Reason}
+			continue
+		}
+		if exemption, exempted := rl.ruleCache.Exemption(request); exempted {
+			l.decisions[i] = &structs.Decision{Allowed: true, Bypass: exemption}
+			continue
+		}
 
-	// fetch valid rules for the given request from cache
-	rulesInCache := rl.ruleCache.GetValidRules(request)
-	if len(rulesInCache) == 0 {
-		rl.logger.Info("no rules found in cache for %v\n", request)
-		return true, nil
+		// plans are only looked up for the entities of types that have any
+		planKeys = append(planKeys, rl.ruleCache.PlanEntities(request)...)
+		checked = append(checked, i)
 	}
 
-	// create entity state request from cached rules
-	stateRequest := store.CreateStateRequest(rulesInCache)
+	var plans map[string]string
+	if len(planKeys) > 0 {
+		var err error
+		if plans, err = rl.stateStore.GetPlans(ctx, planKeys); err != nil {
+			return nil, fmt.Errorf("failed to retrieve plans - %w\n", err)
+		}
+	}
+
+	// fetch valid rules for the given requests from cache and create one entity state request for all of them
+	stateRequest := make(store.StateRequestMap)
+	for _, i := range checked {
+		l.rules[i] = rl.ruleCache.GetValidRules(requests[i], plans)
+		if len(l.rules[i]) == 0 {
+			rl.logger.Info("no rules found in cache for %v\n", requests[i])
+			l.decisions[i] = &structs.Decision{Allowed: true}
+			continue
+		}
+		store.MergeStateRequests(stateRequest, store.CreateStateRequest(l.rules[i]))
+	}
+	if len(stateRequest) == 0 {
+		return l, nil
+	}
 
 	// fetch the current state from backing store
-	stateMap, err := rl.stateStore.GetState(ctx, stateRequest)
-	//rl.logger.Info("state map snap - %#v\n", stateMap)
-	if err != nil {
-		return false, fmt.Errorf("failed to retrieve state - %w\n", err)
+	var err error
+	if l.state, err = rl.stateStore.GetState(ctx, stateRequest); err != nil {
+		return nil, fmt.Errorf("failed to retrieve state - %w\n", err)
 	}
+	return l, nil
+}
 
-	// check if the rules allow the current state to be updated
-	pass, err := rl.checker.Allowed(rulesInCache, stateMap)
+// storeState writes the state of the updated entities to the backing store in one go
+func (rl *rateLimiter) storeState(ctx context.Context, stateMap store.StateMap, updated map[string]struct{}) error {
+	if len(updated) == 0 {
+		return nil
+	}
+	changed := make(store.StateMap, len(updated))
+	for entityKey := range updated {
+		changed[entityKey] = stateMap[entityKey]
+	}
+	// TODO: can be done is async but what about errors?
+	if err := rl.stateStore.SetState(ctx, changed); err != nil {
+		return fmt.Errorf("failed to store state - %w\n", err)
+	}
+	return nil
+}
+
+func (rl *rateLimiter) UpdateRules(update *structs.RuleImport, action enums.RuleAction) error {
+	var err error
+	if rl.ruleStore != nil {
+		_, err = rl.shareRules(func() (*structs.RuleImport, error) {
+			return rl.ruleCache.Preview(update, action)
+		})
+	} else {
+		err = rl.ruleCache.SaveRules(update, action)
+	}
 	if err != nil {
-		return false, fmt.Errorf("strategy: pass check failure - %w\n", err)
+		return fmt.Errorf("Failed to update rules - %w\n", err)
 	}
-	if !pass {
-		return false, nil
+	return nil
+}
+
+// ReplaceRules atomically swaps the complete rule set for the one imported and returns its version
+func (rl *rateLimiter) ReplaceRules(rules *structs.RuleImport) (uint64, error) {
+	version, err := rl.replaceRules(rules)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to replace rules - %w\n", err)
 	}
+	return version, nil
+}
 
-	// change the state by incrementing counters/updating log windows depending upon the strategy
-	if err := rl.checker.UpdateState(rulesInCache, stateMap); err != nil {
-		return false, fmt.Errorf("strategy: update failure - %w\n", err)
+func (rl *rateLimiter) replaceRules(rules *structs.RuleImport) (uint64, error) {
+	if rl.ruleStore != nil {
+		return rl.shareRules(func() (*structs.RuleImport, error) {
+			return rl.ruleCache.Import(rules, enums.RuleAdd)
+		})
 	}
+	return rl.ruleCache.ReplaceRules(rules)
+}
 
-	// update the state to the backing store (TODO: can be done is async but what about errors?)
-	//rl.logger.Info("state before sending to redis %#v\n", stateMap)
-	if err := rl.stateStore.SetState(ctx, stateMap); err != nil {
-		return false, fmt.Errorf("failed to store state - %w\n", err)
+// RollbackRules restores the rule set of a previous version, which is published as a new version
+func (rl *rateLimiter) RollbackRules(version uint64) (uint64, error) {
+	var newVersion uint64
+	var err error
+	if rl.ruleStore != nil {
+		newVersion, err = rl.shareRules(func() (*structs.RuleImport, error) {
+			return rl.ruleCache.Export(version)
+		})
+	} else {
+		newVersion, err = rl.ruleCache.Rollback(version)
 	}
+	if err != nil {
+		return 0, fmt.Errorf("Failed to roll back rules - %w\n", err)
+	}
+	return newVersion, nil
+}
 
-	return true, nil
+func (rl *rateLimiter) RulesVersion() uint64 {
+	return rl.ruleCache.Version()
 }
 
-func (rl *rateLimiter) UpdateRules(update *structs.RuleImport, action enums.RuleAction) error {
-	if err := rl.ruleCache.SaveRules(update, action); err != nil {
-		return fmt.Errorf("Failed to update rules - %w\n", err)
+// ValidateRules reports every problem in the import as structs.ValidationErrors without applying it
+func (rl *rateLimiter) ValidateRules(update *structs.RuleImport, action enums.RuleAction) error {
+	return rl.ruleCache.Validate(update, action)
+}
+
+// DiffRules reports what replacing the rules in use with the import would change, without replacing them
+func (rl *rateLimiter) DiffRules(rules *structs.RuleImport) (*structs.RuleDiff, error) {
+	return rl.ruleCache.Diff(rules)
+}
+
+// DryRunRules reports what UpdateRules would change, it fails the same way UpdateRules does without applying anything
+func (rl *rateLimiter) DryRunRules(update *structs.RuleImport, action enums.RuleAction) (*structs.RuleDiff, error) {
+	return rl.ruleCache.DryRun(update, action)
+}
+
+// Subscribe replaces the rules with every rule set the source delivers until the context is done.
+// Rule sets that fail validation are rejected and the source keeps reporting them through its status.
+func (rl *rateLimiter) Subscribe(ctx context.Context, src source.RuleSource) {
+	go func() {
+		if err := src.Watch(ctx, rl.replaceRules); err != nil {
+			rl.logger.Error("rule source stopped - %s\n", err.Error())
+		}
+	}()
+}
+
+// AssignPlan puts the entity on one of the plans of its type, which is persisted in the state store.
+// Its requests are then evaluated against the plan's rules, an empty plan takes the entity off its plan.
+func (rl *rateLimiter) AssignPlan(ctx context.Context, entityType, entityName, plan string) error {
+	if plan != "" && !rl.ruleCache.HasPlan(entityType, plan) {
+		return fmt.Errorf("no plan %s exists for entity type %s\n", plan, entityType)
+	}
+	if err := rl.stateStore.SetPlan(ctx, helpers.FormKey(entityType, entityName), plan); err != nil {
+		return fmt.Errorf("Failed to assign plan - %w\n", err)
 	}
 	return nil
 }
 
+// GetPlan returns the plan the entity is assigned to, empty if it is not on any
+func (rl *rateLimiter) GetPlan(ctx context.Context, entityType, entityName string) (string, error) {
+	entityKey := helpers.FormKey(entityType, entityName)
+	plans, err := rl.stateStore.GetPlans(ctx, []string{entityKey})
+	if err != nil {
+		return "", fmt.Errorf("Failed to get plan - %w\n", err)
+	}
+	return plans[entityKey], nil
+}
+
 func (rl *rateLimiter) GetRulesByKeys(keys []string) map[string]structs.EntityRules {
 	return rl.ruleCache.GetRulesForKeys(keys)
 }
+
+// QueryRules returns a page of the rules in use that match the query, see structs.RuleQuery
+func (rl *rateLimiter) QueryRules(query *structs.RuleQuery) (*structs.RuleQueryResult, error) {
+	result, err := rl.ruleCache.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query rules - %w\n", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	structs "github.com/pronei/nogo/shared"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(...any)  {}
+func (nopLogger) Debug(...any) {}
+func (nopLogger) Error(...any) {}
+func (nopLogger) Warn(...any)  {}
+func (nopLogger) Fatal(...any) {}
+func (nopLogger) Panic(...any) {}
+
+// testLimiter creates a rate limiter on the in-memory store for the user rules passed,
+// in a namespace of its own that is closed with the test
+func testLimiter(t *testing.T, strategyType string, rules ...structs.AttributeRule) *rateLimiter {
+	t.Helper()
+	config := &structs.RateLimiterConfig{
+		Namespace:      t.Name(),
+		StrategyConfig: structs.StrategyConfig{Type: strategyType, TimeUnit: constants.Second},
+		StorageType:    enums.InMemoryStorage,
+	}
+	imported := &structs.RuleImport{EntityRuleMap: map[string]structs.EntityRules{
+		"user": {EntityType: "user", EntityAttributes: rules},
+	}}
+	limiter, err := Create(nopLogger{}, config, imported)
+	if err != nil {
+		t.Fatalf("could not create rate limiter - %v", err)
+	}
+	rl := limiter.(*rateLimiter)
+	t.Cleanup(rl.Close)
+	return rl
+}
+
+func userRequest(name string, attributes map[string]string) *structs.LimitRequest {
+	return &structs.LimitRequest{Parameters: map[string]structs.EntityParameters{
+		name: {EntityType: "user", AttributesMap: attributes},
+	}}
+}
+
+func TestExpiredRulesAreDroppedAsRequestsComeIn(t *testing.T) {
+	until := time.Now().Add(50 * time.Millisecond)
+	rl := testLimiter(t, "rolling_window", structs.AttributeRule{
+		AttributeType: "tier", AttributeValue: "free", ActiveUntil: &until,
+		Rates: []structs.Rate{{Duration: 60, Limit: 1}},
+	})
+	ctx := context.Background()
+	request := userRequest("u1", map[string]string{"tier": "free"})
+	version := rl.RulesVersion()
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := rl.Allowed(ctx, request); err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if got := rl.RulesVersion(); got != version {
+		t.Fatalf("rules were collected at version %d before the collect interval passed", got)
+	}
+
+	// the next request once the interval has passed drops the expired rule
+	rl.nextCollect.Store(time.Now().UnixNano())
+	if _, err := rl.Allowed(ctx, request); err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for rl.RulesVersion() == version {
+		if time.Now().After(deadline) {
+			t.Fatal("expired rule was not dropped")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pronei/nogo/internal/store"
+	"github.com/pronei/nogo/internal/strategy"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// Inspect reports the limit, usage, remaining amount and reset time of every rate and bucket of the rules
+// matching the request, along with whether it would be allowed right now. Nothing is consumed.
+func (rl *rateLimiter) Inspect(ctx context.Context, request *structs.LimitRequest) (*structs.Inspection, error) {
+	loaded, err := rl.load(ctx, []*structs.LimitRequest{request})
+	if err != nil {
+		return nil, err
+	}
+
+	inspection := &structs.Inspection{}
+	if decision := loaded.decisions[0]; decision != nil {
+		inspection.Decision = *decision
+		return inspection, nil
+	}
+
+	enforced, _ := splitShadow(loaded.rules[0], rl.shadow)
+	if inspection.Allowed, err = rl.checker.Allowed(enforced, loaded.state); err != nil {
+		return nil, fmt.Errorf("strategy: pass check failure - %w\n", err)
+	}
+	// a request that would use a credit is allowed, nothing is taken
+	if !inspection.Allowed {
+		if _, err = rl.useCredits(ctx, enforced, loaded.state, false, &inspection.Decision); err != nil {
+			return nil, err
+		}
+	}
+	if err := rl.inspect(inspection, loaded.rules[0], loaded.state); err != nil {
+		return nil, err
+	}
+	return inspection, nil
+}
+
+// EvaluateAndInspect works like EvaluateAndUpdate and reports the usage of the request's rules after the update
+// along with the decision, from the same read of the state
+func (rl *rateLimiter) EvaluateAndInspect(ctx context.Context, request *structs.LimitRequest) (*structs.Inspection, error) {
+	loaded, err := rl.evaluateLoaded(ctx, []*structs.LimitRequest{request}, true)
+	if err != nil {
+		return nil, err
+	}
+	inspection := &structs.Inspection{Decision: *loaded.decisions[0]}
+	if len(loaded.rules[0]) == 0 {
+		return inspection, nil
+	}
+	if err := rl.inspect(inspection, loaded.rules[0], loaded.state); err != nil {
+		return nil, err
+	}
+	return inspection, nil
+}
+
+// inspect adds the usage of the rules to the inspection, and when they deny the request how long it takes
+// until the enforced ones grant it again
+func (rl *rateLimiter) inspect(inspection *structs.Inspection, rules map[string]structs.EntityRules, state store.StateMap) error {
+	usage, err := rl.checker.Inspect(rules, state)
+	if err != nil {
+		return fmt.Errorf("strategy: inspection failure - %w\n", err)
+	}
+	inspection.Usage = rl.usage(usage)
+	if inspection.Allowed {
+		return nil
+	}
+	enforced, _ := splitShadow(rules, rl.shadow)
+	_, wait, err := rl.checker.Grantable(enforced, state, 1)
+	if err != nil {
+		return fmt.Errorf("strategy: grant check failure - %w\n", err)
+	}
+	if wait >= 0 {
+		inspection.RetryAfter = time.Duration(wait) * rl.unit
+	} else {
+		inspection.Never = true
+	}
+	return nil
+}
+
+// usage converts the usage found by the strategy, listing it by entity, rule and rate
+func (rl *rateLimiter) usage(usage []strategy.Usage) []structs.Usage {
+	var converted []structs.Usage
+	for _, ruleUsage := range usage {
+		inspected := structs.Usage{
+			EntityType: ruleUsage.EntityType,
+			EntityName: ruleUsage.EntityName,
+			Rule:       ruleUsage.Rule,
+			Shadow:     ruleUsage.Rule.Shadow || rl.shadow,
+			Limit:      ruleUsage.Limit,
+			Used:       ruleUsage.Used,
+			Remaining:  max(ruleUsage.Limit-ruleUsage.Used, 0),
+		}
+		if ruleUsage.Rate >= 0 {
+			rate := ruleUsage.Rule.Rates[ruleUsage.Rate]
+			inspected.Rate = &rate
+		}
+		if ruleUsage.Limit > 0 {
+			inspected.Utilisation = float64(ruleUsage.Used) / float64(ruleUsage.Limit)
+		} else if ruleUsage.Used > 0 {
+			inspected.Utilisation = 1
+		}
+		if ruleUsage.ResetAt >= 0 {
+			inspected.ResetAt = time.Unix(0, ruleUsage.ResetAt*int64(rl.unit))
+		}
+		converted = append(converted, inspected)
+	}
+
+	// the rules come out of a map, the usage is listed by entity, rule and rate
+	sort.SliceStable(converted, func(i, j int) bool {
+		a, b := &converted[i], &converted[j]
+		if a.EntityType != b.EntityType {
+			return a.EntityType < b.EntityType
+		}
+		if a.EntityName != b.EntityName {
+			return a.EntityName < b.EntityName
+		}
+		return a.Rule.Key() < b.Rule.Key()
+	})
+	return converted
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	structs "github.com/pronei/nogo/shared"
+)
+
+func TestPlansWithTheSameNameOnEveryEntityType(t *testing.T) {
+	config := &structs.RateLimiterConfig{
+		Namespace:      t.Name(),
+		StrategyConfig: structs.StrategyConfig{Type: "rolling_window", TimeUnit: constants.Second},
+		StorageType:    enums.InMemoryStorage,
+	}
+	imported := &structs.RuleImport{
+		EntityRuleMap: map[string]structs.EntityRules{
+			"user":   {EntityType: "user", EntityLimit: 1, EntityDuration: 3600},
+			"tenant": {EntityType: "tenant", EntityLimit: 1, EntityDuration: 3600},
+		},
+		Plans: []structs.EntityRules{
+			{EntityType: "user", EntityName: "pro", EntityLimit: 2, EntityDuration: 3600},
+			{EntityType: "tenant", EntityName: "pro", EntityLimit: 3, EntityDuration: 3600},
+		},
+	}
+	limiter, err := Create(nopLogger{}, config, imported)
+	if err != nil {
+		t.Fatalf("could not create rate limiter - %v", err)
+	}
+	rl := limiter.(*rateLimiter)
+	t.Cleanup(rl.Close)
+	ctx := context.Background()
+
+	for _, entityType := range []string{"user", "tenant"} {
+		if err := rl.AssignPlan(ctx, entityType, "e1", "pro"); err != nil {
+			t.Fatalf("could not assign %s e1 to pro - %v", entityType, err)
+		}
+	}
+
+	// each entity gets the limit of the pro plan of its own type
+	for entityType, want := range map[string]int{"user": 2, "tenant": 3} {
+		request := &structs.LimitRequest{Parameters: map[string]structs.EntityParameters{"e1": {EntityType: entityType, AttributesMap: map[string]string{}}}}
+		allowed := 0
+		for range 5 {
+			decision, err := rl.EvaluateAndUpdate(ctx, request)
+			if err != nil {
+				t.Fatalf("evaluation failed - %v", err)
+			}
+			if decision.Allowed {
+				allowed++
+			}
+		}
+		if allowed != want {
+			t.Errorf("%s on the pro plan was allowed %d requests, want %d", entityType, allowed, want)
+		}
+	}
+
+	exported, err := rl.ruleCache.Export(0)
+	if err != nil {
+		t.Fatalf("could not export rules - %v", err)
+	}
+	if len(exported.Plans) != 2 {
+		t.Errorf("expected both pro plans to be exported, got %+v", exported.Plans)
+	}
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/helpers"
+	"github.com/pronei/nogo/internal/store"
+	"github.com/pronei/nogo/internal/strategy"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// Refund takes back exactly the log entries and tokens consumed by the request the receipt was issued for, it
+// reports whether anything was refunded. Receipts are kept when they are issued and the refund goes by the ID of
+// the receipt alone, taking back what was kept for it rather than what the receipt it is given says. A receipt is
+// only ever refunded once, refunding it again or after it has expired does nothing. Receipts that never expire are
+// kept for constants.MaxReceiptTTL. The refund is not atomic with other updates of the state, which is read and
+// written back in separate round-trips to the store like for AllowAndUpdate.
+func (rl *rateLimiter) Refund(ctx context.Context, request *structs.LimitRequest, receipt *structs.Receipt) (bool, error) {
+	if receipt == nil || receipt.ID == "" {
+		return false, nil
+	}
+	kept, err := rl.stateStore.TakeReceipt(ctx, receipt.ID)
+	if err != nil {
+		return false, fmt.Errorf("Failed to refund receipt %s - %w\n", receipt.ID, err)
+	}
+	if kept == nil {
+		return false, nil
+	}
+
+	for _, entry := range kept.Entries {
+		if params, exists := request.Parameters[entry.EntityName]; !exists || params.EntityType != entry.EntityType {
+			rl.restoreReceipt(ctx, kept)
+			return false, fmt.Errorf("receipt %s was not issued for this request, it has no entity %s of type %s\n",
+				receipt.ID, entry.EntityName, entry.EntityType)
+		}
+	}
+
+	if err := rl.refund(ctx, kept); err != nil {
+		// the receipt can be refunded again when nothing was
+		rl.restoreReceipt(ctx, kept)
+		return false, fmt.Errorf("Failed to refund receipt %s - %w\n", receipt.ID, err)
+	}
+	return true, nil
+}
+
+// refund takes what the receipt consumed back out of the state, whether or not it was refunded before
+func (rl *rateLimiter) refund(ctx context.Context, receipt *structs.Receipt) error {
+	stateRequest := make(store.StateRequestMap)
+	for _, entry := range receipt.Entries {
+		store.MergeStateRequests(stateRequest, store.StateRequestMap{
+			helpers.FormKey(entry.EntityType, entry.EntityName): {
+				Type:            entry.EntityType,
+				Name:            entry.EntityName,
+				AttributeStates: []store.AttributeRequest{{Key: entry.Key}},
+			},
+		})
+	}
+	stateMap, err := rl.stateStore.GetState(ctx, stateRequest)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve state - %w\n", err)
+	}
+	return rl.storeState(ctx, stateMap, strategy.Refund(stateMap, receipt))
+}
+
+// keepReceipts keeps the receipts of the decisions so that they can be refunded. The decisions have been made and
+// their state stored already, a receipt that cannot be kept is removed from its decision as it cannot be refunded.
+func (rl *rateLimiter) keepReceipts(ctx context.Context, decisions []*structs.Decision) {
+	var receipts []*structs.Receipt
+	for _, decision := range decisions {
+		if decision != nil && decision.Receipt != nil {
+			receipts = append(receipts, decision.Receipt)
+		}
+	}
+	if len(receipts) == 0 {
+		return
+	}
+	if err := rl.saveReceipts(ctx, receipts); err != nil {
+		rl.logger.Error("cannot keep receipts, they cannot be refunded - %s\n", err.Error())
+		for _, decision := range decisions {
+			if decision != nil {
+				decision.Receipt = nil
+			}
+		}
+	}
+}
+
+// saveReceipts keeps the receipts until they expire
+func (rl *rateLimiter) saveReceipts(ctx context.Context, receipts []*structs.Receipt) error {
+	issued := make([]store.IssuedReceipt, 0, len(receipts))
+	for _, receipt := range receipts {
+		if ttl, live := rl.receiptTTL(receipt); live {
+			issued = append(issued, store.IssuedReceipt{Receipt: receipt, TTL: ttl})
+		}
+	}
+	if err := rl.stateStore.SaveReceipts(ctx, issued); err != nil {
+		return fmt.Errorf("failed to keep receipts - %w\n", err)
+	}
+	return nil
+}
+
+// restoreReceipt keeps a receipt that was taken again when nothing was refunded for it
+func (rl *rateLimiter) restoreReceipt(ctx context.Context, receipt *structs.Receipt) {
+	if err := rl.saveReceipts(ctx, []*structs.Receipt{receipt}); err != nil {
+		rl.logger.Error("cannot restore receipt %s - %s\n", receipt.ID, err.Error())
+	}
+}
+
+// receiptTTL is how long the receipt has left until it expires, capped at constants.MaxReceiptTTL for receipts
+// that never do. It is not live once it has expired.
+func (rl *rateLimiter) receiptTTL(receipt *structs.Receipt) (time.Duration, bool) {
+	if receipt.ExpiresAt == 0 {
+		return constants.MaxReceiptTTL, true
+	}
+	now := time.Now().UnixNano() / int64(rl.unit)
+	if now >= receipt.ExpiresAt {
+		return 0, false
+	}
+	return time.Duration(receipt.ExpiresAt-now) * rl.unit, true
+}
+
+// newReceiptID returns a random ID for a receipt
+func newReceiptID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot generate receipt ID - %w\n", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	structs "github.com/pronei/nogo/shared"
+)
+
+func TestRefundOnce(t *testing.T) {
+	for _, strategyType := range []string{"rolling_window", "static_window", "fixed_bucket"} {
+		t.Run(strategyType, func(t *testing.T) {
+			rule := structs.AttributeRule{AttributeType: "tier", AttributeValue: "free"}
+			if strategyType == "fixed_bucket" {
+				rule.Bucket = structs.Bucket{Duration: 3600, Refill: 1, Cost: 1, Maximum: 1}
+			} else {
+				rule.Rates = []structs.Rate{{Duration: 3600, Limit: 1}}
+			}
+			rl := testLimiter(t, strategyType, rule)
+			ctx := context.Background()
+			request := userRequest("u1", map[string]string{"tier": "free"})
+
+			decision, err := rl.EvaluateAndUpdate(ctx, request)
+			if err != nil || !decision.Allowed || decision.Receipt == nil || decision.Receipt.ID == "" {
+				t.Fatalf("first request: decision = %+v, err = %v", decision, err)
+			}
+			if allowed, _ := rl.Allowed(ctx, request); allowed {
+				t.Fatal("second request allowed before the refund")
+			}
+
+			for i, want := range []bool{true, false} {
+				refunded, err := rl.Refund(ctx, request, decision.Receipt)
+				if err != nil {
+					t.Fatalf("refund failed - %v", err)
+				}
+				if refunded != want {
+					t.Errorf("refund %d: refunded = %v, want %v", i+1, refunded, want)
+				}
+			}
+			if allowed, _ := rl.Allowed(ctx, request); !allowed {
+				t.Error("request denied after the refund")
+			}
+		})
+	}
+}
+
+func TestRefundTakesBackOnlyWhatWasKept(t *testing.T) {
+	rule := structs.AttributeRule{AttributeType: "tier", AttributeValue: "free", Rates: []structs.Rate{{Duration: 3600, Limit: 2}}}
+	rl := testLimiter(t, "rolling_window", rule)
+	ctx := context.Background()
+	request := userRequest("u1", map[string]string{"tier": "free"})
+
+	var receipts []*structs.Receipt
+	for i := 0; i < 2; i++ {
+		decision, err := rl.EvaluateAndUpdate(ctx, request)
+		if err != nil || !decision.Allowed {
+			t.Fatalf("request %d: decision = %+v, err = %v", i+1, decision, err)
+		}
+		receipts = append(receipts, decision.Receipt)
+	}
+
+	// a receipt that was never issued refunds nothing
+	forged := *receipts[0]
+	forged.ID = "forged"
+	if refunded, err := rl.Refund(ctx, request, &forged); err != nil || refunded {
+		t.Errorf("forged receipt: refunded = %v, err = %v", refunded, err)
+	}
+
+	// entries changed after the receipt was issued take back no more than it consumed
+	tampered := *receipts[0]
+	tampered.Entries = []structs.ReceiptEntry{tampered.Entries[0]}
+	tampered.Entries[0].Logs = 100
+	if refunded, err := rl.Refund(ctx, request, &tampered); err != nil || !refunded {
+		t.Fatalf("tampered receipt: refunded = %v, err = %v", refunded, err)
+	}
+	if allowed, _ := rl.Allowed(ctx, request); !allowed {
+		t.Fatal("request denied after the refund")
+	}
+	if _, err := rl.EvaluateAndUpdate(ctx, request); err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if allowed, _ := rl.Allowed(ctx, request); allowed {
+		t.Error("refund took back more than the receipt consumed")
+	}
+}
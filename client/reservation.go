@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pronei/nogo/internal/constants"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// Reserve holds the estimated units of the request when all its rules allow that many, units count like they do
+// for AllowUpTo but either all of them or none are reserved. The reservation is settled with the actual units once
+// they are known, if it is not settled within the reservation timeout the estimate is returned.
+// Like AllowUpTo, checking and holding the estimate is not atomic with concurrent updates of the same entity.
+func (rl *rateLimiter) Reserve(ctx context.Context, request *structs.LimitRequest, estimate int64) (*structs.Reservation, error) {
+	if estimate <= 0 {
+		return nil, fmt.Errorf("cannot reserve %d units, reserving at least one is required\n", estimate)
+	}
+	loaded, err := rl.load(ctx, []*structs.LimitRequest{request})
+	if err != nil {
+		return nil, err
+	}
+
+	// blocked, exempted and unlimited requests hold nothing that would have to be settled
+	reservation := &structs.Reservation{Estimate: estimate}
+	if decision := loaded.decisions[0]; decision != nil {
+		reservation.Decision = *decision
+		return reservation, nil
+	}
+
+	enforced, shadow := splitShadow(loaded.rules[0], rl.shadow)
+	granted, _, err := rl.checker.Grantable(enforced, loaded.state, estimate)
+	if err != nil {
+		return nil, fmt.Errorf("strategy: grant check failure - %w\n", err)
+	}
+	if granted < estimate {
+		return reservation, nil
+	}
+	if reservation.ID, err = newReceiptID(); err != nil {
+		return nil, err
+	}
+	rl.sweeping.Do(func() {
+		go rl.sweepReservations(rl.ctx)
+	})
+	if err := rl.consumeUnits(ctx, loaded, enforced, shadow, estimate, &reservation.Decision); err != nil {
+		return nil, err
+	}
+	reservation.Allowed = true
+	reservation.ExpiresAt = time.Now().Add(rl.reservationTimeout)
+
+	err = rl.saveReceipts(ctx, []*structs.Receipt{reservation.Receipt})
+	if err == nil {
+		err = rl.stateStore.SaveReservation(ctx, reservation)
+	}
+	if err != nil {
+		// the estimate would never be settled or returned otherwise
+		if refundErr := rl.refund(ctx, reservation.Receipt); refundErr != nil {
+			rl.logger.Error("cannot return estimate of reservation %s - %s\n", reservation.ID, refundErr.Error())
+		}
+		return nil, fmt.Errorf("Failed to reserve - %w\n", err)
+	}
+	rl.reportShadow(ctx, []*structs.LimitRequest{request}, []*structs.Decision{&reservation.Decision})
+	return reservation, nil
+}
+
+// Settle charges the actual units of a reserved request in place of the estimate. Units reserved in excess are
+// returned and the ones missing are charged regardless of the limits, as they have been used already. It reports
+// false when the reservation was settled before, or expired and its estimate was returned.
+func (rl *rateLimiter) Settle(ctx context.Context, request *structs.LimitRequest, reservation *structs.Reservation, actual int64) (bool, error) {
+	if actual < 0 {
+		return false, fmt.Errorf("cannot settle %d units, the actual units cannot be negative\n", actual)
+	}
+	if reservation == nil || reservation.ID == "" {
+		return false, nil
+	}
+	held, err := rl.stateStore.TakeReservation(ctx, reservation.ID)
+	if err != nil {
+		return false, fmt.Errorf("Failed to settle reservation %s - %w\n", reservation.ID, err)
+	}
+	if held == nil {
+		return false, nil
+	}
+
+	// the receipt is taken like a refund would, a receipt that was refunded already holds nothing any more
+	returned, charged := held.Estimate-actual, actual-held.Estimate
+	var kept *structs.Receipt
+	if _, live := rl.receiptTTL(held.Receipt); live {
+		if kept, err = rl.stateStore.TakeReceipt(ctx, held.Receipt.ID); err != nil {
+			return false, rl.unsettle(ctx, held, nil, err)
+		}
+		if kept == nil {
+			returned, charged = 0, actual
+		}
+	}
+
+	if returned > 0 && kept != nil {
+		err = rl.refund(ctx, partialReceipt(kept, returned, held.Estimate))
+	} else if charged > 0 {
+		err = rl.charge(ctx, request, charged)
+	}
+	if err != nil {
+		return false, rl.unsettle(ctx, held, kept, err)
+	}
+	return true, nil
+}
+
+// unsettle puts back a reservation that failed to be settled, along with its receipt if it was taken, so that
+// it can be settled again
+func (rl *rateLimiter) unsettle(ctx context.Context, held *structs.Reservation, kept *structs.Receipt, err error) error {
+	if kept != nil {
+		rl.restoreReceipt(ctx, kept)
+	}
+	if saveErr := rl.stateStore.SaveReservation(ctx, held); saveErr != nil {
+		rl.logger.Error("cannot put back reservation %s - %s\n", held.ID, saveErr.Error())
+	}
+	return fmt.Errorf("Failed to settle reservation %s - %w\n", held.ID, err)
+}
+
+// charge takes the units from the state of every enforced rule of the request without checking them,
+// shadow rules are only charged when they allow as many like they are for AllowUpTo
+func (rl *rateLimiter) charge(ctx context.Context, request *structs.LimitRequest, units int64) error {
+	loaded, err := rl.load(ctx, []*structs.LimitRequest{request})
+	if err != nil {
+		return err
+	}
+	if loaded.decisions[0] != nil {
+		return nil
+	}
+	decision := &structs.Decision{Allowed: true}
+	enforced, shadow := splitShadow(loaded.rules[0], rl.shadow)
+	if err := rl.consumeUnits(ctx, loaded, enforced, shadow, units, decision); err != nil {
+		return err
+	}
+	rl.reportShadow(ctx, []*structs.LimitRequest{request}, []*structs.Decision{decision})
+	return nil
+}
+
+// partialReceipt is the part of the receipt for units out of the ones it was issued for
+func partialReceipt(receipt *structs.Receipt, units, of int64) *structs.Receipt {
+	partial := *receipt
+	partial.Entries = make([]structs.ReceiptEntry, len(receipt.Entries))
+	for i, entry := range receipt.Entries {
+		entry.Logs = entry.Logs * units / of
+		entry.Tokens = entry.Tokens * units / of
+		partial.Entries[i] = entry
+	}
+	return &partial
+}
+
+// sweepReservations periodically returns the estimates of reservations that were not settled in time
+func (rl *rateLimiter) sweepReservations(ctx context.Context) {
+	ticker := time.NewTicker(constants.ReservationSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for {
+				expired, err := rl.stateStore.TakeExpiredReservations(ctx, now, constants.ReservationSweepBatch)
+				if err != nil {
+					rl.logger.Warn("failed to find expired reservations - %s\n", err.Error())
+				}
+				for _, reservation := range expired {
+					rl.expireReservation(ctx, reservation)
+				}
+				if err != nil || len(expired) < constants.ReservationSweepBatch {
+					break
+				}
+			}
+		}
+	}
+}
+
+// expireReservation returns the estimate of a reservation unless its receipt was refunded or has expired
+func (rl *rateLimiter) expireReservation(ctx context.Context, reservation *structs.Reservation) {
+	if _, live := rl.receiptTTL(reservation.Receipt); !live {
+		return
+	}
+	kept, err := rl.stateStore.TakeReceipt(ctx, reservation.Receipt.ID)
+	if err == nil && kept != nil {
+		if err = rl.refund(ctx, kept); err != nil {
+			rl.restoreReceipt(ctx, kept)
+		}
+	}
+	if err != nil {
+		// it is looked at again with the next sweep
+		rl.logger.Warn("failed to return estimate of reservation %s - %s\n", reservation.ID, err.Error())
+		if saveErr := rl.stateStore.SaveReservation(ctx, reservation); saveErr != nil {
+			rl.logger.Error("cannot put back reservation %s - %s\n", reservation.ID, saveErr.Error())
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	structs "github.com/pronei/nogo/shared"
+)
+
+func TestReserveAndSettle(t *testing.T) {
+	enforced := structs.AttributeRule{AttributeType: "tier", AttributeValue: "free", Rates: []structs.Rate{{Duration: 3600, Limit: 10}}}
+	shadow := structs.AttributeRule{AttributeType: "tier", AttributeValue: "free", Shadow: true, Rates: []structs.Rate{{Duration: 3600, Limit: 4}}}
+	tests := []struct {
+		name         string
+		estimate     int64
+		actual       int64
+		wantReserved bool
+		// used of the enforced and the shadow rule once settled
+		wantUsed       int64
+		wantShadowUsed int64
+	}{
+		{name: "excess is returned", estimate: 5, actual: 2, wantReserved: true, wantUsed: 2, wantShadowUsed: 0},
+		{name: "missing units are charged", estimate: 3, actual: 6, wantReserved: true, wantUsed: 6, wantShadowUsed: 3},
+		{name: "estimate over the limit", estimate: 11, wantReserved: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := testLimiter(t, "rolling_window", enforced, shadow)
+			ctx := context.Background()
+			request := userRequest("u1", map[string]string{"tier": "free"})
+
+			reservation, err := rl.Reserve(ctx, request, tt.estimate)
+			if err != nil {
+				t.Fatalf("reserve failed - %v", err)
+			}
+			if reservation.Allowed != tt.wantReserved {
+				t.Fatalf("reserved = %v, want %v", reservation.Allowed, tt.wantReserved)
+			}
+			if !tt.wantReserved {
+				return
+			}
+
+			for i, want := range []bool{true, false} {
+				settled, err := rl.Settle(ctx, request, reservation, tt.actual)
+				if err != nil {
+					t.Fatalf("settle failed - %v", err)
+				}
+				if settled != want {
+					t.Errorf("settle %d: settled = %v, want %v", i+1, settled, want)
+				}
+			}
+
+			inspection, err := rl.Inspect(ctx, request)
+			if err != nil {
+				t.Fatalf("inspection failed - %v", err)
+			}
+			for _, usage := range inspection.Usage {
+				want := tt.wantUsed
+				if usage.Shadow {
+					want = tt.wantShadowUsed
+				}
+				if usage.Used != want {
+					t.Errorf("shadow = %v: used = %d, want %d", usage.Shadow, usage.Used, want)
+				}
+			}
+		})
+	}
+}
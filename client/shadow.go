@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	structs "github.com/pronei/nogo/shared"
+)
+
+// splitShadow separates the rules that are enforced from the shadow rules, all of them are shadow rules
+// when the namespace is in shadow mode
+func splitShadow(rules map[string]structs.EntityRules, shadowAll bool) (enforced, shadow map[string]structs.EntityRules) {
+	if shadowAll {
+		return map[string]structs.EntityRules{}, rules
+	}
+	enforced = make(map[string]structs.EntityRules)
+	shadow = make(map[string]structs.EntityRules)
+	for entityKey, entity := range rules {
+		enforcedEntity, shadowEntity := entity, entity
+		enforcedEntity.EntityAttributes, shadowEntity.EntityAttributes = nil, nil
+		for _, rule := range entity.EntityAttributes {
+			if rule.Shadow {
+				shadowEntity.EntityAttributes = append(shadowEntity.EntityAttributes, rule)
+			} else {
+				enforcedEntity.EntityAttributes = append(enforcedEntity.EntityAttributes, rule)
+			}
+		}
+		if len(enforcedEntity.EntityAttributes) > 0 {
+			enforced[entityKey] = enforcedEntity
+		}
+		if len(shadowEntity.EntityAttributes) > 0 {
+			shadow[entityKey] = shadowEntity
+		}
+	}
+	return enforced, shadow
+}
+
+// checkShadow checks every shadow rule on its own with check, the ones that would have denied the request are
+// added to the decision and the ones that pass are returned so that their state can be updated with the rest
+func (rl *rateLimiter) checkShadow(shadow map[string]structs.EntityRules, decision *structs.Decision,
+	check func(single map[string]structs.EntityRules) (bool, error)) (map[string]structs.EntityRules, error) {
+
+	passed := make(map[string]structs.EntityRules)
+	for entityKey, entity := range shadow {
+		for _, rule := range entity.EntityAttributes {
+			single := entity
+			single.EntityAttributes = []structs.AttributeRule{rule}
+			pass, err := check(map[string]structs.EntityRules{entityKey: single})
+			if err != nil {
+				return nil, fmt.Errorf("strategy: shadow check failure - %w\n", err)
+			}
+			if !pass {
+				decision.WouldDeny = append(decision.WouldDeny, structs.ShadowDenial{
+					EntityType: entity.EntityType,
+					EntityName: entity.EntityName,
+					Rule:       rule,
+				})
+				continue
+			}
+			passedEntity := passed[entityKey]
+			passedEntity.EntityType, passedEntity.EntityName = entity.EntityType, entity.EntityName
+			passedEntity.EntityAttributes = append(passedEntity.EntityAttributes, rule)
+			passed[entityKey] = passedEntity
+		}
+	}
+	return passed, nil
+}
+
+func mergeRules(into, from map[string]structs.EntityRules) map[string]structs.EntityRules {
+	merged := make(map[string]structs.EntityRules, len(into)+len(from))
+	for entityKey, entity := range into {
+		merged[entityKey] = entity
+	}
+	for entityKey, entity := range from {
+		existing, exists := merged[entityKey]
+		if !exists {
+			merged[entityKey] = entity
+			continue
+		}
+		existing.EntityAttributes = append(existing.EntityAttributes[:len(existing.EntityAttributes):len(existing.EntityAttributes)], entity.EntityAttributes...)
+		merged[entityKey] = existing
+	}
+	return merged
+}
+
+// reportShadow calls the shadow hook with every decision where a shadow rule would have denied the request
+func (rl *rateLimiter) reportShadow(ctx context.Context, requests []*structs.LimitRequest, decisions []*structs.Decision) {
+	if rl.shadowHook == nil {
+		return
+	}
+	for i, decision := range decisions {
+		if len(decision.WouldDeny) > 0 {
+			rl.shadowHook(ctx, requests[i], decision)
+		}
+	}
+}
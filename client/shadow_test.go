@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	structs "github.com/pronei/nogo/shared"
+)
+
+func TestShadowRuleNextToEnforcedRule(t *testing.T) {
+	enforced := structs.AttributeRule{AttributeType: "user_tier", AttributeValue: "free", Rates: []structs.Rate{{Duration: 60, Limit: 10}}}
+	shadow := structs.AttributeRule{AttributeType: "user_tier", AttributeValue: "free", Shadow: true, Rates: []structs.Rate{{Duration: 60, Limit: 2}}}
+	rl := testLimiter(t, "rolling_window", enforced, shadow)
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		decision, err := rl.EvaluateAndUpdate(ctx, userRequest("u1", map[string]string{"user_tier": "free"}))
+		if err != nil {
+			t.Fatalf("evaluation failed - %v", err)
+		}
+		if !decision.Allowed {
+			t.Fatalf("request %d denied by a shadow rule", i)
+		}
+		if wouldDeny := len(decision.WouldDeny) > 0; wouldDeny != (i == 3) {
+			t.Errorf("request %d: would deny = %v", i, wouldDeny)
+		}
+	}
+
+	inspection, err := rl.Inspect(ctx, userRequest("u1", map[string]string{"user_tier": "free"}))
+	if err != nil {
+		t.Fatalf("inspection failed - %v", err)
+	}
+	if len(inspection.Usage) != 2 {
+		t.Fatalf("got usage for %d rules, want 2", len(inspection.Usage))
+	}
+	for _, usage := range inspection.Usage {
+		// the shadow rule stops being charged once it would deny, the enforced one is charged once per request
+		want := int64(3)
+		if usage.Shadow {
+			want = 2
+		}
+		if usage.Used != want {
+			t.Errorf("shadow = %v: used = %d, want %d", usage.Shadow, usage.Used, want)
+		}
+	}
+}
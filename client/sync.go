@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	"github.com/pronei/nogo/internal/store"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// loadSharedRules picks up the rules already shared in the namespace, the imported rules are only
+// used to seed the namespace when it has none yet
+func (rl *rateLimiter) loadSharedRules(importedRules *structs.RuleImport) error {
+	ctx := context.Background()
+	version, rules, err := rl.ruleStore.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		_, err := rl.shareRules(func() (*structs.RuleImport, error) {
+			// another instance seeded the namespace first, its rules were loaded on the conflict
+			if rl.ruleCache.Version() != 0 {
+				return nil, nil
+			}
+			return rl.ruleCache.Import(importedRules, enums.RuleAdd)
+		})
+		return err
+	}
+	if importedRules != nil && len(importedRules.EntityRuleMap) > 0 {
+		rl.logger.Info("using shared rules of version %d instead of the rules passed\n", version)
+	}
+	_, err = rl.ruleCache.ReplaceRulesAt(rules, version)
+	return err
+}
+
+// shareRules saves the rule set built by change to Redis on top of the version in use and applies it
+// locally under the version it was saved as. Changes are rebuilt on top of the latest rules when
+// another instance got there first.
+func (rl *rateLimiter) shareRules(change func() (*structs.RuleImport, error)) (uint64, error) {
+	rl.ruleLock.Lock()
+	defer rl.ruleLock.Unlock()
+
+	ctx := context.Background()
+	for attempt := 0; attempt < constants.RuleSyncAttempts; attempt++ {
+		rules, err := change()
+		if err != nil {
+			return 0, err
+		}
+		// nothing left to change once rebuilt on top of the latest rules
+		if rules == nil {
+			return rl.ruleCache.Version(), nil
+		}
+		version, err := rl.ruleStore.Save(ctx, rl.ruleCache.Version(), rules)
+		if errors.Is(err, store.ErrRulesConflict) {
+			if err := rl.refreshRules(ctx); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if _, err := rl.ruleCache.ReplaceRulesAt(rules, version); err != nil {
+			return 0, err
+		}
+		return version, nil
+	}
+	return 0, fmt.Errorf("gave up after %d attempts - %w", constants.RuleSyncAttempts, store.ErrRulesConflict)
+}
+
+// syncRules applies the versions announced by other instances, with a periodic check
+// in case an announcement was missed while the subscription was down
+func (rl *rateLimiter) syncRules(ctx context.Context, updates <-chan uint64) {
+	ticker := time.NewTicker(constants.RuleSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case version, ok := <-updates:
+			if !ok {
+				// resubscribe on the next tick, refreshing then covers whatever was missed
+				updates = nil
+				continue
+			}
+			if version <= rl.ruleCache.Version() {
+				continue
+			}
+		case <-ticker.C:
+			if updates == nil {
+				var err error
+				if updates, err = rl.ruleStore.Updates(ctx); err != nil {
+					rl.logger.Warn("failed to resubscribe to rule updates - %s\n", err.Error())
+				}
+			}
+		}
+		if err := rl.refreshRules(ctx); err != nil {
+			rl.logger.Warn("failed to sync rules, staying on version %d - %s\n", rl.ruleCache.Version(), err.Error())
+		}
+	}
+}
+
+// refreshRules applies the shared rules if they are newer than the ones in use
+func (rl *rateLimiter) refreshRules(ctx context.Context) error {
+	version, rules, err := rl.ruleStore.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if version <= rl.ruleCache.Version() {
+		return nil
+	}
+	if _, err := rl.ruleCache.ReplaceRulesAt(rules, version); err != nil {
+		return fmt.Errorf("shared rules of version %d are invalid - %w", version, err)
+	}
+	rl.logger.Info("synced rules to version %d\n", version)
+	return nil
+}
+
+// collectLocally drops the rules that have expired every constants.RuleCollectInterval as requests come in
+// when the rules are not shared, so that a rate limiter that does not share them runs nothing in the background
+func (rl *rateLimiter) collectLocally(now time.Time) {
+	if rl.ruleStore != nil {
+		return
+	}
+	next := rl.nextCollect.Load()
+	if now.UnixNano() < next || !rl.nextCollect.CompareAndSwap(next, now.Add(constants.RuleCollectInterval).UnixNano()) {
+		return
+	}
+	go func() {
+		before := rl.ruleCache.Version()
+		rl.ruleCache.Collect(now)
+		if version := rl.ruleCache.Version(); version != before {
+			rl.logger.Info("dropped expired rules, now at version %d\n", version)
+		}
+	}()
+}
+
+// collectRules periodically drops rules that have expired through Redis when the rules are shared
+func (rl *rateLimiter) collectRules(ctx context.Context) {
+	ticker := time.NewTicker(constants.RuleCollectInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			before := rl.ruleCache.Version()
+			_, err := rl.shareRules(func() (*structs.RuleImport, error) {
+				rules, _ := rl.ruleCache.WithoutExpired(now)
+				return rules, nil
+			})
+			if err != nil {
+				rl.logger.Warn("failed to drop expired rules - %s\n", err.Error())
+			} else if version := rl.ruleCache.Version(); version != before {
+				rl.logger.Info("dropped expired rules, now at version %d\n", version)
+			}
+		}
+	}
+}
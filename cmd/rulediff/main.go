@@ -0,0 +1,92 @@
+// rulediff compares a rule file with the rules currently in use and prints the changes as JSON.
+//
+// Usage:
+//
+//	rulediff -unit ms -current rules.json -incoming new-rules.json [-action replace|add|update|delete]
+//
+// The time unit of the namespace the rules are for is required, integer durations in the rule files are read in it.
+// Rule files are read as JSON, YAML or TOML depending on their extension.
+// With the default action of replace the incoming file is the complete new rule set, the other actions
+// do a dry run of UpdateRules with the incoming file. Invalid rules are reported and exit with status 1.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pronei/nogo/internal/cache"
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	"github.com/pronei/nogo/internal/helpers"
+	structs "github.com/pronei/nogo/shared"
+	"github.com/pronei/nogo/source"
+)
+
+var actions = map[string]enums.RuleAction{
+	"add":    enums.RuleAdd,
+	"update": enums.RuleUpdate,
+	"delete": enums.RuleDelete,
+}
+
+func main() {
+	currentFile := flag.String("current", "", "rule file with the rules in use, none when empty")
+	incomingFile := flag.String("incoming", "", "rule file to compare with the rules in use")
+	action := flag.String("action", "replace", "replace, add, update or delete")
+	strategy := flag.String("strategy", "rolling_window", "strategy of the namespace the rules are for")
+	timeUnit := flag.String("unit", "", "time unit of the namespace the rules are for (ns, us, ms, s, m or h), required")
+	flag.Parse()
+
+	if *incomingFile == "" || *timeUnit == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if !helpers.Contains(constants.ValidTimeUnits, *timeUnit) {
+		log.Fatalf("unknown time unit %s, expected one of %v\n", *timeUnit, constants.ValidTimeUnits)
+	}
+	ruleCache := cache.New(&structs.RateLimiterConfig{
+		StrategyConfig: structs.StrategyConfig{Type: *strategy, TimeUnit: *timeUnit},
+	})
+	if *currentFile != "" {
+		if _, err := ruleCache.ReplaceRules(readRules(*currentFile)); err != nil {
+			log.Fatalf("current rules are invalid - %s\n", err.Error())
+		}
+	}
+
+	incoming := readRules(*incomingFile)
+	var diff *structs.RuleDiff
+	var err error
+	if *action == "replace" {
+		diff, err = ruleCache.Diff(incoming)
+	} else if ruleAction, exists := actions[*action]; exists {
+		diff, err = ruleCache.DryRun(incoming, ruleAction)
+	} else {
+		log.Fatalf("unknown action %s\n", *action)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "incoming rules cannot be applied - %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	out, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		log.Fatalf("cannot marshal diff - %s\n", err.Error())
+	}
+	fmt.Println(string(out))
+}
+
+func readRules(name string) *structs.RuleImport {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		log.Fatalf("cannot read rule file - %s\n", err.Error())
+	}
+	// the format is picked by the extension of the file, like for rules loaded by a file source
+	rules, err := source.Parse(name, b)
+	if err != nil {
+		log.Fatalf("cannot unmarshal rules in %s - %s\n", name, err.Error())
+	}
+	return rules
+}
@@ -0,0 +1,38 @@
+// ruleschema writes the JSON Schema of rule files, generated from structs.RuleImport, so that editors
+// can validate rule files written in JSON, YAML or TOML.
+//
+//go:generate go run . -o ../../schema/rules.schema.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"reflect"
+
+	"github.com/pronei/nogo/internal/schema"
+	structs "github.com/pronei/nogo/shared"
+)
+
+const schemaID = "https://raw.githubusercontent.com/pronei/nogo/main/schema/rules.schema.json"
+
+func main() {
+	output := flag.String("o", "", "file to write the schema to, stdout when empty")
+	flag.Parse()
+
+	generated := schema.Generate(reflect.TypeOf(structs.RuleImport{}), schemaID)
+	b, err := json.MarshalIndent(generated, "", "  ")
+	if err != nil {
+		log.Fatalf("cannot marshal schema - %s\n", err.Error())
+	}
+	b = append(b, '\n')
+
+	if *output == "" {
+		os.Stdout.Write(b)
+		return
+	}
+	if err := os.WriteFile(*output, b, 0o644); err != nil {
+		log.Fatalf("cannot write schema - %s\n", err.Error())
+	}
+}
@@ -11,6 +11,7 @@ import (
 	rateClient "github.com/pronei/nogo/client"
 	"github.com/pronei/nogo/internal/enums"
 	structs "github.com/pronei/nogo/shared"
+	"github.com/pronei/nogo/source"
 	"go.uber.org/zap"
 )
 
@@ -62,6 +63,8 @@ func main() {
 	if err != nil {
 		log.Fatalf("cannot create client - %s\n", err.Error())
 	}
+	// stops syncing rules and sweeping reservations when they are used
+	defer client.(rateClient.Closer).Close()
 
 	reqBytes, err := ioutil.ReadFile(requestsFileName)
 	if err != nil {
@@ -73,7 +76,11 @@ func main() {
 		log.Fatalf("cannot unmarshal request tests - %s\n", err.Error())
 	}
 
-	ctx := context.TODO()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// edits to the rule file are picked up while the sample runs
+	client.(rateClient.RuleManager).Subscribe(ctx, source.NewFileSource(logger.Sugar(), ruleFileName, source.FileOptions{}))
 
 	fmt.Printf("request ID\tallowed?\n")
 	for reqId, req := range requests.RequestMap {
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/pronei/nogo/internal/enums"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// Sections of the rule import that are not made of attribute rules
+const (
+	exemptionsSection = "exemptions"
+	blocksSection     = "blocks"
+)
+
+// Diff compares the rules in use with the rule set that replacing them with the import would result in
+func (rc *RuleCache) Diff(imported *structs.RuleImport) (*structs.RuleDiff, error) {
+	imported, err := rc.Import(imported, enums.RuleAdd)
+	if err != nil {
+		return nil, err
+	}
+	next := newDraft()
+	if err := next.apply(imported, enums.RuleAdd); err != nil {
+		return nil, err
+	}
+	current := rc.current.Load()
+	return diff(current.version, current.draft(), next), nil
+}
+
+// DryRun validates and applies the import like SaveRules does, on a copy of the rules in use,
+// and reports what saving it would change
+func (rc *RuleCache) DryRun(imported *structs.RuleImport, action enums.RuleAction) (*structs.RuleDiff, error) {
+	imported, err := rc.Import(imported, action)
+	if err != nil {
+		return nil, err
+	}
+	current := rc.current.Load()
+	next := current.draft()
+	if err := next.apply(imported, action); err != nil {
+		return nil, err
+	}
+	return diff(current.version, current.draft(), next), nil
+}
+
+func diff(version uint64, from, to *draft) *structs.RuleDiff {
+	result := &structs.RuleDiff{Version: version}
+	diffSection(result, ruleMapSection, from.rules.entries(), to.rules.entries())
+	diffSection(result, overridesSection, scopedRules(from.overrides.entries()), scopedRules(to.overrides.entries()))
+	diffSection(result, plansSection, scopedRules(from.plans.entries()), scopedRules(to.plans.entries()))
+	diffSection(result, exemptionsSection, from.exemptions.entries(), to.exemptions.entries())
+	diffSection(result, blocksSection, from.blocks.entries(), to.blocks.entries())
+	return result
+}
+
+func scopedRules(scoped map[string]scopedRule) map[string]structs.AttributeRule {
+	rules := make(map[string]structs.AttributeRule, len(scoped))
+	for key, s := range scoped {
+		rules[key] = s.rule
+	}
+	return rules
+}
+
+func diffSection[V any](result *structs.RuleDiff, section string, from, to map[string]V) {
+	for _, key := range sortedKeys(from) {
+		if _, exists := to[key]; !exists {
+			result.Removed = append(result.Removed, structs.RuleChange{Section: section, Key: key})
+		}
+	}
+	for _, key := range sortedKeys(to) {
+		previous, exists := from[key]
+		if !exists {
+			result.Added = append(result.Added, structs.RuleChange{Section: section, Key: key})
+			continue
+		}
+		var fields []structs.FieldChange
+		diffFields(&fields, "", toJSON(previous), toJSON(to[key]))
+		if len(fields) > 0 {
+			result.Modified = append(result.Modified, structs.RuleChange{Section: section, Key: key, Fields: fields})
+		}
+	}
+}
+
+// toJSON turns an entry into its generic JSON form, so that fields are compared and named as they are written
+func toJSON(entry any) any {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal(b, &value); err != nil {
+		return nil
+	}
+	return value
+}
+
+func diffFields(fields *[]structs.FieldChange, path string, from, to any) {
+	switch fromValue := from.(type) {
+	case map[string]any:
+		toValue, ok := to.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make(map[string]bool)
+		for key := range fromValue {
+			keys[key] = true
+		}
+		for key := range toValue {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			diffFields(fields, fieldPath, fromValue[key], toValue[key])
+		}
+		return
+	case []any:
+		toValue, ok := to.([]any)
+		if !ok {
+			break
+		}
+		for i := 0; i < len(fromValue) || i < len(toValue); i++ {
+			var fromItem, toItem any
+			if i < len(fromValue) {
+				fromItem = fromValue[i]
+			}
+			if i < len(toValue) {
+				toItem = toValue[i]
+			}
+			diffFields(fields, fmt.Sprintf("%s[%d]", path, i), fromItem, toItem)
+		}
+		return
+	}
+	if !reflect.DeepEqual(from, to) {
+		*fields = append(*fields, structs.FieldChange{Path: path, From: from, To: to})
+	}
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	"github.com/pronei/nogo/internal/helpers"
+	"github.com/pronei/nogo/internal/immutables"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// Sections of the rule import a rule is found in, they prefix the keys pages are ordered by
+const (
+	ruleMapSection   = "ruleMap"
+	overridesSection = "overrides"
+	plansSection     = "plans"
+)
+
+type queryEntry struct {
+	section   string
+	key       string
+	rule      structs.AttributeRule
+	scoped    scopedRule
+	exemption structs.Exemption
+	block     structs.Block
+}
+
+// position orders the entries across sections and is what pages continue after
+func (e *queryEntry) position() string {
+	return helpers.FormKey(e.section, e.key)
+}
+
+// Query returns a page of the rules in use that match the query, as of the time of the call
+func (rc *RuleCache) Query(query *structs.RuleQuery) (*structs.RuleQueryResult, error) {
+	switch query.Kind {
+	case "", enums.RuleKindAttribute, enums.RuleKindCompound, enums.RuleKindEntityLimit, enums.RuleKindExemption, enums.RuleKindBlock:
+	default:
+		return nil, fmt.Errorf("unknown rule kind %v\n", string(query.Kind))
+	}
+	if query.AttributeValue != "" && query.AttributeType == "" {
+		return nil, fmt.Errorf("attribute value %q has no type\n", query.AttributeValue)
+	}
+	if query.Limit < 0 {
+		return nil, fmt.Errorf("limit cannot be negative, got %d\n", query.Limit)
+	}
+
+	rules := rc.current.Load()
+	now := time.Now()
+	var entries []queryEntry
+	rules.rules.Range(func(key string, rule structs.AttributeRule) bool {
+		if matchesRule(query, helpers.ParseKey(key, 0), &rule, now) {
+			entries = append(entries, queryEntry{section: ruleMapSection, key: key, rule: rule})
+		}
+		return true
+	})
+	for section, scoped := range map[string]*immutables.Map[string, scopedRule]{overridesSection: rules.overrides, plansSection: rules.plans} {
+		scoped.Range(func(key string, s scopedRule) bool {
+			if matchesRule(query, s.entityType, &s.rule, now) {
+				entries = append(entries, queryEntry{section: section, key: key, rule: s.rule, scoped: s})
+			}
+			return true
+		})
+	}
+	rules.exemptions.Range(func(key string, exemption structs.Exemption) bool {
+		if matchesQuery(query, exemption.EntityType, enums.RuleKindExemption, true, nil, attributeConditions(exemption.AttributeType, exemption.AttributeValue)) {
+			entries = append(entries, queryEntry{section: exemptionsSection, key: key, exemption: exemption})
+		}
+		return true
+	})
+	rules.blocks.Range(func(key string, block structs.Block) bool {
+		if matchesQuery(query, block.EntityType, enums.RuleKindBlock, block.ActiveAt(now), nil, attributeConditions(block.AttributeType, block.AttributeValue)) {
+			entries = append(entries, queryEntry{section: blocksSection, key: key, block: block})
+		}
+		return true
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].position() < entries[j].position()
+	})
+
+	start := sort.Search(len(entries), func(i int) bool {
+		return entries[i].position() > query.After
+	})
+	end := len(entries)
+	if query.Limit > 0 && start+query.Limit < end {
+		end = start + query.Limit
+	}
+
+	// the page is put together as a draft of its own so that it exports like the complete rule set
+	page := newDraft()
+	for _, entry := range entries[start:end] {
+		switch entry.section {
+		case ruleMapSection:
+			page.rules.set(entry.key, entry.rule)
+		case overridesSection:
+			page.overrides.set(entry.key, entry.scoped)
+		case plansSection:
+			page.plans.set(entry.key, entry.scoped)
+		case exemptionsSection:
+			page.exemptions.set(entry.key, entry.exemption)
+		case blocksSection:
+			page.blocks.set(entry.key, entry.block)
+		}
+	}
+	result := &structs.RuleQueryResult{
+		Version: rules.version,
+		Rules:   page.export(),
+		Total:   len(entries),
+	}
+	if end < len(entries) {
+		result.Next = entries[end-1].position()
+	}
+	return result, nil
+}
+
+func matchesRule(query *structs.RuleQuery, entityType string, rule *structs.AttributeRule, now time.Time) bool {
+	return matchesQuery(query, entityType, ruleKind(rule), rule.ActiveAt(now), rule.Tags, rule.MatchConditions())
+}
+
+func matchesQuery(query *structs.RuleQuery, entityType string, kind enums.RuleKind, active bool, tags []string, conditions []structs.Condition) bool {
+	if query.EntityType != "" && query.EntityType != entityType {
+		return false
+	}
+	if query.Kind != "" && query.Kind != kind {
+		return false
+	}
+	if query.Active != nil && *query.Active != active {
+		return false
+	}
+	if query.Tag != "" && !helpers.Contains(tags, query.Tag) {
+		return false
+	}
+	if query.AttributeType == "" {
+		return true
+	}
+	for _, condition := range conditions {
+		if condition.AttributeType == query.AttributeType &&
+			(query.AttributeValue == "" || condition.AttributeValue == query.AttributeValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeConditions is the condition of an exemption or block on an attribute, if it has one
+func attributeConditions(attributeType, attributeValue string) []structs.Condition {
+	if attributeType == "" {
+		return nil
+	}
+	return []structs.Condition{{AttributeType: attributeType, AttributeValue: attributeValue}}
+}
+
+func ruleKind(rule *structs.AttributeRule) enums.RuleKind {
+	switch {
+	case rule.AttributeType == constants.EntityLimitAttribute:
+		return enums.RuleKindEntityLimit
+	case rule.IsCompound():
+		return enums.RuleKindCompound
+	default:
+		return enums.RuleKindAttribute
+	}
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	structs "github.com/pronei/nogo/shared"
+)
+
+func TestQueryIncludesExemptionsAndBlocks(t *testing.T) {
+	rc := New(&structs.RateLimiterConfig{StrategyConfig: structs.StrategyConfig{Type: "rolling_window", TimeUnit: constants.Second}})
+	imported := &structs.RuleImport{
+		EntityRuleMap: map[string]structs.EntityRules{
+			"user": {EntityType: "user", EntityAttributes: []structs.AttributeRule{
+				{AttributeType: "tier", AttributeValue: "free", Rates: []structs.Rate{{Duration: 60, Limit: 10}}},
+			}},
+		},
+		Exemptions: []structs.Exemption{{EntityType: "user", EntityName: "qa"}},
+		Blocks:     []structs.Block{{EntityType: "user", AttributeType: "tier", AttributeValue: "banned", Reason: "abuse"}},
+	}
+	if err := rc.SaveRules(imported, enums.RuleAdd); err != nil {
+		t.Fatalf("could not save rules - %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		query      structs.RuleQuery
+		total      int
+		exemptions int
+		blocks     int
+	}{
+		{name: "everything", query: structs.RuleQuery{}, total: 3, exemptions: 1, blocks: 1},
+		{name: "exemptions", query: structs.RuleQuery{Kind: enums.RuleKindExemption}, total: 1, exemptions: 1},
+		{name: "blocks", query: structs.RuleQuery{Kind: enums.RuleKindBlock}, total: 1, blocks: 1},
+		{name: "by attribute", query: structs.RuleQuery{AttributeType: "tier", AttributeValue: "banned"}, total: 1, blocks: 1},
+		{name: "by tag", query: structs.RuleQuery{Tag: "any"}, total: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := rc.Query(&tt.query)
+			if err != nil {
+				t.Fatalf("query failed - %v", err)
+			}
+			if result.Total != tt.total || len(result.Rules.Exemptions) != tt.exemptions || len(result.Rules.Blocks) != tt.blocks {
+				t.Errorf("total = %d, exemptions = %d, blocks = %d, want %d, %d, %d",
+					result.Total, len(result.Rules.Exemptions), len(result.Rules.Blocks), tt.total, tt.exemptions, tt.blocks)
+			}
+		})
+	}
+}
+
+func TestExemptionAndBlockOnSameEntityAreKeptApart(t *testing.T) {
+	rc := New(&structs.RateLimiterConfig{StrategyConfig: structs.StrategyConfig{Type: "rolling_window", TimeUnit: constants.Second}})
+	imported := &structs.RuleImport{
+		Exemptions: []structs.Exemption{{EntityType: "user", EntityName: "qa"}, {EntityType: "user", AttributeType: "tier", AttributeValue: "free"}},
+		Blocks:     []structs.Block{{EntityType: "user", EntityName: "qa", Reason: "abuse"}, {EntityType: "user", AttributeType: "tier", AttributeValue: "free", Reason: "abuse"}},
+	}
+	if err := rc.SaveRules(imported, enums.RuleAdd); err != nil {
+		t.Fatalf("could not save rules - %v", err)
+	}
+
+	result, err := rc.Query(&structs.RuleQuery{})
+	if err != nil {
+		t.Fatalf("query failed - %v", err)
+	}
+	if result.Total != 4 || len(result.Rules.Exemptions) != 2 || len(result.Rules.Blocks) != 2 {
+		t.Errorf("total = %d, exemptions = %d, blocks = %d, want 4, 2, 2",
+			result.Total, len(result.Rules.Exemptions), len(result.Rules.Blocks))
+	}
+
+	for i := range imported.Blocks {
+		if blockKey(&imported.Blocks[i]) == exemptionKey(&imported.Exemptions[i]) {
+			t.Errorf("block %+v has the same key as exemption %+v", imported.Blocks[i], imported.Exemptions[i])
+		}
+	}
+}
@@ -2,52 +2,327 @@ package cache
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/patrickmn/go-cache"
+	"github.com/pronei/nogo/internal/constants"
 	"github.com/pronei/nogo/internal/enums"
 	"github.com/pronei/nogo/internal/helpers"
+	"github.com/pronei/nogo/internal/validation"
 	structs "github.com/pronei/nogo/shared"
 )
 
 type RuleCache struct {
-	c *cache.Cache
+	strategy   structs.StrategyConfig
+	evaluation enums.Evaluation
+
+	// readers only ever load the current snapshot, writers are serialized by the lock
+	current atomic.Pointer[ruleSet]
+	lock    sync.Mutex
+
+	// previously published snapshots that can be rolled back to, oldest first
+	history     []*ruleSet
+	historySize int
 }
 
+// Validate checks the import against the namespace's strategy without saving it
+func (rc *RuleCache) Validate(imported *structs.RuleImport, action enums.RuleAction) error {
+	return validation.Rules(imported, action, &rc.strategy)
+}
+
+// Import validates the import and returns a copy of it with its durations in the time unit of the namespace,
+// which is what is applied and shared. The import passed is not changed.
+func (rc *RuleCache) Import(imported *structs.RuleImport, action enums.RuleAction) (*structs.RuleImport, error) {
+	if err := rc.Validate(imported, action); err != nil {
+		return nil, err
+	}
+	unit, err := helpers.GetTimeInDurationWithError(1, rc.strategy.TimeUnit)
+	if err != nil {
+		return nil, err
+	}
+	return imported.Normalised(unit)
+}
+
+// SaveRules applies the import on top of the current rules as a new version,
+// either every change in the import is applied or none of them are
 func (rc *RuleCache) SaveRules(imported *structs.RuleImport, action enums.RuleAction) error {
-	for _, entity := range imported.EntityRuleMap {
-		for _, attribute := range entity.EntityAttributes {
-			cacheKey := helpers.FormKey(entity.EntityType, attribute.AttributeType, attribute.AttributeValue)
-			switch action {
-			case enums.RuleDelete:
-				rc.c.Delete(cacheKey)
-			case enums.RuleAdd:
-				if _, exists := rc.c.Get(cacheKey); exists {
-					return fmt.Errorf("duplicate rule exists for %s\n", cacheKey)
-				}
-				rc.c.Set(cacheKey, attribute, cache.NoExpiration)
-			case enums.RuleUpdate:
-				if err := rc.c.Replace(cacheKey, attribute, cache.NoExpiration); err != nil {
-					return fmt.Errorf("cannot update key - %w", err)
-				}
+	imported, err := rc.Import(imported, action)
+	if err != nil {
+		return err
+	}
+
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	current := rc.current.Load()
+	d := current.draft()
+	if err := d.apply(imported, action); err != nil {
+		return err
+	}
+	rc.publish(d.publish(current.version + 1))
+	return nil
+}
+
+// ReplaceRules swaps every rule in the cache for the ones in the import and returns the new version
+func (rc *RuleCache) ReplaceRules(imported *structs.RuleImport) (uint64, error) {
+	imported, err := rc.Import(imported, enums.RuleAdd)
+	if err != nil {
+		return 0, err
+	}
+
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	d := newDraft()
+	if err := d.apply(imported, enums.RuleAdd); err != nil {
+		return 0, err
+	}
+	next := d.publish(rc.current.Load().version + 1)
+	rc.publish(next)
+	return next.version, nil
+}
+
+// Rollback publishes the rules of an earlier version again, under a new version so that they keep increasing
+func (rc *RuleCache) Rollback(version uint64) (uint64, error) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	current := rc.current.Load()
+	for _, previous := range rc.history {
+		if previous.version == version {
+			next := *previous
+			next.version = current.version + 1
+			rc.publish(&next)
+			return next.version, nil
+		}
+	}
+	return 0, fmt.Errorf("version %d is not available for rollback, current version is %d\n", version, current.version)
+}
+
+// ReplaceRulesAt publishes the rules under a version decided elsewhere, e.g. shared by several instances.
+// Rules older than the ones in use are ignored, which is reported by returning false.
+func (rc *RuleCache) ReplaceRulesAt(imported *structs.RuleImport, version uint64) (bool, error) {
+	imported, err := rc.Import(imported, enums.RuleAdd)
+	if err != nil {
+		return false, err
+	}
+
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	if version <= rc.current.Load().version {
+		return false, nil
+	}
+	d := newDraft()
+	if err := d.apply(imported, enums.RuleAdd); err != nil {
+		return false, err
+	}
+	rc.publish(d.publish(version))
+	return true, nil
+}
+
+// Preview returns the complete rule set that saving the import would result in, without saving it
+func (rc *RuleCache) Preview(imported *structs.RuleImport, action enums.RuleAction) (*structs.RuleImport, error) {
+	imported, err := rc.Import(imported, action)
+	if err != nil {
+		return nil, err
+	}
+	d := rc.current.Load().draft()
+	if err := d.apply(imported, action); err != nil {
+		return nil, err
+	}
+	return d.export(), nil
+}
+
+// Export returns the rules of a version still held by the cache, 0 being the current one
+func (rc *RuleCache) Export(version uint64) (*structs.RuleImport, error) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	current := rc.current.Load()
+	if version == 0 || version == current.version {
+		return current.draft().export(), nil
+	}
+	for _, previous := range rc.history {
+		if previous.version == version {
+			return previous.draft().export(), nil
+		}
+	}
+	return nil, fmt.Errorf("version %d is not available, current version is %d\n", version, current.version)
+}
+
+// Collect publishes the rules without the ones expired by t as a new version, if any have expired
+func (rc *RuleCache) Collect(t time.Time) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	current := rc.current.Load()
+	d := current.draft()
+	if d.collect(t) > 0 {
+		rc.publish(d.publish(current.version + 1))
+	}
+}
+
+// WithoutExpired returns the current rules minus the ones expired by t, false means none have expired
+func (rc *RuleCache) WithoutExpired(t time.Time) (*structs.RuleImport, bool) {
+	d := rc.current.Load().draft()
+	if d.collect(t) == 0 {
+		return nil, false
+	}
+	return d.export(), true
+}
+
+// Version of the rules currently in use
+func (rc *RuleCache) Version() uint64 {
+	return rc.current.Load().version
+}
+
+// Versions lists the versions that can be rolled back to, oldest first
+func (rc *RuleCache) Versions() []uint64 {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	versions := make([]uint64, len(rc.history))
+	for i, previous := range rc.history {
+		versions[i] = previous.version
+	}
+	return versions
+}
+
+// publish must be called with the lock held
+func (rc *RuleCache) publish(next *ruleSet) {
+	previous := rc.current.Swap(next)
+	if previous == nil || rc.historySize == 0 {
+		return
+	}
+	rc.history = append(rc.history, previous)
+	if len(rc.history) > rc.historySize {
+		rc.history = rc.history[len(rc.history)-rc.historySize:]
+	}
+}
+
+// Block returns the first block active at t that applies to an entity in the request, if any
+func (rc *RuleCache) Block(req *structs.LimitRequest, t time.Time) (*structs.Block, bool) {
+	rules := rc.current.Load()
+	if rules.blocks.Len() == 0 {
+		return nil, false
+	}
+	for entityName, params := range req.Parameters {
+		key := helpers.FormKey(constants.NameBlock, params.EntityType, entityName)
+		if block, exists := rules.blocks.Get(key); exists && block.ActiveAt(t) {
+			return &block, true
+		}
+		for attributeType, attributeValue := range params.AttributesMap {
+			key := helpers.FormKey(constants.AttributeBlock, params.EntityType, attributeType, attributeValue)
+			if block, exists := rules.blocks.Get(key); exists && block.ActiveAt(t) {
+				return &block, true
+			}
+		}
+		patterns, _ := rules.patterns.Get(params.EntityType)
+		for _, candidate := range patterns {
+			if !candidate.block.ActiveAt(t) {
+				continue
+			}
+			subject, exists := entityName, true
+			if candidate.block.AttributeType != "" {
+				subject, exists = params.AttributesMap[candidate.block.AttributeType]
+			}
+			if exists && candidate.pattern.MatchString(subject) {
+				return &candidate.block, true
 			}
 		}
 	}
-	return nil
+	return nil, false
 }
 
-func (rc *RuleCache) GetValidRules(req *structs.LimitRequest) map[string]structs.EntityRules {
+// Exemption returns the first exemption applying to an entity in the request, if any
+func (rc *RuleCache) Exemption(req *structs.LimitRequest) (*structs.Exemption, bool) {
+	exemptions := rc.current.Load().exemptions
+	if exemptions.Len() == 0 {
+		return nil, false
+	}
+	for entityName, params := range req.Parameters {
+		key := helpers.FormKey(constants.NameExemption, params.EntityType, entityName)
+		if exemption, exists := exemptions.Get(key); exists {
+			return &exemption, true
+		}
+		for attributeType, attributeValue := range params.AttributesMap {
+			key := helpers.FormKey(constants.AttributeExemption, params.EntityType, attributeType, attributeValue)
+			if exemption, exists := exemptions.Get(key); exists {
+				return &exemption, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// GetValidRules finds the rules matching the request that are active at the moment,
+// plans holds the plan assigned to each entity in the request by its entity key
+func (rc *RuleCache) GetValidRules(req *structs.LimitRequest, plans map[string]string) map[string]structs.EntityRules {
+	rules := rc.current.Load()
+	now := time.Now()
+	byGroup := rc.evaluation == enums.EvaluationMostSpecific
+
 	result := make(map[string]structs.EntityRules)
 	for entityName, params := range req.Parameters {
+		entityKey := helpers.FormKey(params.EntityType, entityName)
 		var attributes []structs.AttributeRule
 		for attributeType, attributeValue := range params.AttributesMap {
+			if attributeType == constants.EntityLimitAttribute {
+				continue
+			}
 			ruleKey := helpers.FormKey(params.EntityType, attributeType, attributeValue)
-			if val, exists := rc.c.Get(ruleKey); exists {
-				attributeRule := val.(structs.AttributeRule)
-				attributes = append(attributes, attributeRule)
+			// a shadow rule can be defined next to an enforced one on the same attribute, under a key of its own
+			for _, key := range []string{ruleKey, helpers.FormKey(ruleKey, constants.ShadowKey)} {
+				if attributeRule, exists := rules.rules.Get(key); exists && attributeRule.ActiveAt(now) {
+					attributes = append(attributes, attributeRule)
+				}
 			}
+			// each compound rule is anchored on a single condition, so it is only visited once per request
+			compoundKeys, _ := rules.anchors.Get(ruleKey)
+			for _, compoundKey := range compoundKeys {
+				if attributeRule, exists := rules.rules.Get(compoundKey); exists &&
+					attributeRule.ActiveAt(now) && attributeRule.Matches(params.AttributesMap) {
+					attributes = append(attributes, attributeRule)
+				}
+			}
+		}
+		limitRule, hasLimit := rules.rules.Get(helpers.FormKey(params.EntityType, constants.EntityLimitAttribute, constants.AllAttribute))
+
+		// the entity's plan replaces the matching rules of its type, and overrides for the entity replace both
+		var scopes [][]structs.AttributeRule
+		if plan, assigned := plans[entityKey]; assigned {
+			planRules, _ := rules.planRules.Get(helpers.FormKey(params.EntityType, plan))
+			scopes = append(scopes, planRules)
+		}
+		if overrides, exists := rules.entityOverrides.Get(entityKey); exists {
+			scopes = append(scopes, overrides)
+		}
+		for _, scoped := range scopes {
+			var matched []structs.AttributeRule
+			for _, rule := range scoped {
+				switch {
+				case rule.AttributeType == constants.EntityLimitAttribute:
+					limitRule, hasLimit = rule, true
+				case rule.ActiveAt(now) && rule.Matches(params.AttributesMap):
+					matched = append(matched, rule)
+				}
+			}
+			attributes = withOverrides(attributes, matched, byGroup)
+		}
+
+		// shadow rules are measured as if they were in place, they never take the place of an enforced rule
+		if byGroup {
+			enforced, shadow := partitionShadow(attributes)
+			attributes = append(mostSpecific(enforced), mostSpecific(shadow)...)
+		}
+		// the entity limit is not part of any group and applies regardless of the attributes passed
+		if hasLimit {
+			attributes = append(attributes, limitRule)
 		}
 		if len(attributes) > 0 {
-			result[helpers.FormKey(params.EntityType, entityName)] = structs.EntityRules{
+			result[entityKey] = structs.EntityRules{
 				EntityName:       entityName,
 				EntityType:       params.EntityType,
 				EntityAttributes: attributes,
@@ -57,32 +332,145 @@ func (rc *RuleCache) GetValidRules(req *structs.LimitRequest) map[string]structs
 	return result
 }
 
-func (rc *RuleCache) GetRulesForKeys(entityType []string) map[string]structs.EntityRules {
-	entityTypes := make(map[string]bool)
-	for _, entity := range entityType {
-		entityTypes[entity] = true
+// PlanEntities returns the keys of the entities in the request whose type has plans,
+// only those need their plan looked up
+func (rc *RuleCache) PlanEntities(req *structs.LimitRequest) []string {
+	planTypes := rc.current.Load().planTypes
+	if planTypes.Len() == 0 {
+		return nil
+	}
+	var entityKeys []string
+	for entityName, params := range req.Parameters {
+		if _, exists := planTypes.Get(params.EntityType); exists {
+			entityKeys = append(entityKeys, helpers.FormKey(params.EntityType, entityName))
+		}
 	}
+	return entityKeys
+}
+
+// HasPlan checks that a plan exists for the entity type
+func (rc *RuleCache) HasPlan(entityType, plan string) bool {
+	_, exists := rc.current.Load().planRules.Get(helpers.FormKey(entityType, plan))
+	return exists
+}
 
+// GetRulesForKeys returns the rules of the entity types, keyed by entity type like an import's rule map
+func (rc *RuleCache) GetRulesForKeys(entityTypes []string) map[string]structs.EntityRules {
+	exported := rc.current.Load().draft().export()
 	result := make(map[string]structs.EntityRules)
-	rules := rc.c.Items()
-	for k, v := range rules {
-		key := helpers.SplitKeys(k)
-		if entityTypes[key[0]] {
-			attributeRule := v.Object.(structs.AttributeRule)
-			if _, exists := result[key[0]]; exists {
-				entities := result[key[0]]
-				entities.EntityAttributes = append(entities.EntityAttributes, attributeRule)
-				result[key[0]] = entities
-			} else {
-				entities := structs.EntityRules{}
-				entities.EntityAttributes = append(entities.EntityAttributes, attributeRule)
-				result[key[0]] = entities
-			}
+	for _, entityType := range entityTypes {
+		if entity, exists := exported.EntityRuleMap[entityType]; exists {
+			result[entityType] = entity
 		}
 	}
 	return result
 }
 
-func New() *RuleCache {
-	return &RuleCache{c: cache.New(cache.NoExpiration, cache.NoExpiration)}
+// withOverrides drops the rules overridden for an entity and adds the overrides in their place. A rule is
+// overridden by one with the same conditions or, when only the most specific rules are enforced, by any in its group.
+// Shadow overrides are only added, the rules they would override stay in place until they are enforced.
+func withOverrides(attributes, overrides []structs.AttributeRule, byGroup bool) []structs.AttributeRule {
+	if len(overrides) == 0 {
+		return attributes
+	}
+	keys := make(map[string]bool, len(overrides))
+	groups := make(map[string]bool, len(overrides))
+	for i := range overrides {
+		if overrides[i].Shadow {
+			continue
+		}
+		keys[overrides[i].Key()] = true
+		groups[precedenceGroup(&overrides[i])] = true
+	}
+	result := make([]structs.AttributeRule, 0, len(attributes)+len(overrides))
+	for i := range attributes {
+		if keys[attributes[i].Key()] || byGroup && groups[precedenceGroup(&attributes[i])] {
+			continue
+		}
+		result = append(result, attributes[i])
+	}
+	return append(result, overrides...)
+}
+
+func partitionShadow(attributes []structs.AttributeRule) (enforced, shadow []structs.AttributeRule) {
+	for i := range attributes {
+		if attributes[i].Shadow {
+			shadow = append(shadow, attributes[i])
+		} else {
+			enforced = append(enforced, attributes[i])
+		}
+	}
+	return enforced, shadow
+}
+
+// mostSpecific keeps only the highest precedence rule of every group
+func mostSpecific(attributes []structs.AttributeRule) []structs.AttributeRule {
+	winners := make(map[string]int)
+	var groups []string
+	for i := range attributes {
+		group := precedenceGroup(&attributes[i])
+		current, exists := winners[group]
+		if !exists {
+			groups = append(groups, group)
+			winners[group] = i
+			continue
+		}
+		if precedes(&attributes[i], &attributes[current]) {
+			winners[group] = i
+		}
+	}
+	result := make([]structs.AttributeRule, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, attributes[winners[group]])
+	}
+	return result
+}
+
+// precedenceGroup is the group a rule competes in, a rule without a group is in a group of its own and always applies
+func precedenceGroup(rule *structs.AttributeRule) string {
+	if rule.Group == "" {
+		return helpers.FormKey("", rule.Key())
+	}
+	return rule.Group
+}
+
+// precedes orders rules by priority first and then by how specific they are,
+// the rule key breaks any remaining ties so that the outcome does not depend on the request's map order
+func precedes(a, b *structs.AttributeRule) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if sa, sb := specificity(a), specificity(b); sa != sb {
+		return sa > sb
+	}
+	return a.Key() < b.Key()
+}
+
+// specificity is the number of conditions on a rule not counting the catch-all ALL attribute
+func specificity(rule *structs.AttributeRule) int {
+	count := 0
+	for _, condition := range rule.MatchConditions() {
+		if condition.AttributeType != constants.AllAttribute {
+			count++
+		}
+	}
+	return count
+}
+
+func New(config *structs.RateLimiterConfig) *RuleCache {
+	evaluation := config.Evaluation
+	if evaluation == "" {
+		evaluation = enums.EvaluationAll
+	}
+	historySize := constants.DefaultRuleHistory
+	if config.RuleHistory != nil {
+		historySize = max(*config.RuleHistory, 0)
+	}
+	rc := &RuleCache{
+		strategy:    config.StrategyConfig,
+		evaluation:  evaluation,
+		historySize: historySize,
+	}
+	rc.current.Store(newDraft().publish(0))
+	return rc
 }
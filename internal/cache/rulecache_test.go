@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	"github.com/pronei/nogo/internal/helpers"
+	structs "github.com/pronei/nogo/shared"
+)
+
+func TestMostSpecificEnforcesEveryUngroupedRule(t *testing.T) {
+	rc := New(&structs.RateLimiterConfig{
+		StrategyConfig: structs.StrategyConfig{Type: "rolling_window", TimeUnit: constants.Second},
+		Evaluation:     enums.EvaluationMostSpecific,
+	})
+	rate := []structs.Rate{{Duration: 60, Limit: 10}}
+	imported := &structs.RuleImport{
+		EntityRuleMap: map[string]structs.EntityRules{
+			"user": {EntityType: "user", EntityAttributes: []structs.AttributeRule{
+				{AttributeType: "path", AttributeValue: "/a", Rates: rate},
+				{AttributeType: "method", AttributeValue: "GET", Rates: rate},
+				{AttributeType: "tier", AttributeValue: "free", Group: "tokens", Rates: rate},
+				{AttributeType: "segment", AttributeValue: "vip", Group: "tokens", Priority: 10, Rates: rate},
+			}},
+		},
+	}
+	if err := rc.SaveRules(imported, enums.RuleAdd); err != nil {
+		t.Fatalf("could not save rules - %v", err)
+	}
+
+	req := &structs.LimitRequest{Parameters: map[string]structs.EntityParameters{
+		"u1": {EntityType: "user", AttributesMap: map[string]string{"path": "/a", "method": "GET", "tier": "free", "segment": "vip"}},
+	}}
+	var keys []string
+	for _, rule := range rc.GetValidRules(req, nil)[helpers.FormKey("user", "u1")].EntityAttributes {
+		keys = append(keys, rule.Key())
+	}
+	sort.Strings(keys)
+
+	// both ungrouped rules apply, only the highest priority one of the tokens group does
+	want := []string{"method:GET", "path:/a", "segment:vip"}
+	if len(keys) != len(want) {
+		t.Fatalf("rules enforced = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("rules enforced = %v, want %v", keys, want)
+		}
+	}
+}
+
+func TestUngroupedOverrideKeepsOtherUngroupedRules(t *testing.T) {
+	rc := New(&structs.RateLimiterConfig{
+		StrategyConfig: structs.StrategyConfig{Type: "rolling_window", TimeUnit: constants.Second},
+		Evaluation:     enums.EvaluationMostSpecific,
+	})
+	rate := []structs.Rate{{Duration: 60, Limit: 10}}
+	imported := &structs.RuleImport{
+		EntityRuleMap: map[string]structs.EntityRules{
+			"user": {EntityType: "user", EntityAttributes: []structs.AttributeRule{
+				{AttributeType: "path", AttributeValue: "/a", Rates: rate},
+				{AttributeType: "method", AttributeValue: "GET", Rates: rate},
+			}},
+		},
+		Overrides: []structs.EntityRules{{EntityType: "user", EntityName: "u1", EntityAttributes: []structs.AttributeRule{
+			{AttributeType: "path", AttributeValue: "/a", Rates: []structs.Rate{{Duration: 60, Limit: 100}}},
+		}}},
+	}
+	if err := rc.SaveRules(imported, enums.RuleAdd); err != nil {
+		t.Fatalf("could not save rules - %v", err)
+	}
+
+	req := &structs.LimitRequest{Parameters: map[string]structs.EntityParameters{
+		"u1": {EntityType: "user", AttributesMap: map[string]string{"path": "/a", "method": "GET"}},
+	}}
+	limits := make(map[string]int)
+	for _, rule := range rc.GetValidRules(req, nil)[helpers.FormKey("user", "u1")].EntityAttributes {
+		limits[rule.Key()] = rule.Rates[0].Limit
+	}
+
+	// the override only takes the place of the rule with its conditions
+	if len(limits) != 2 || limits["path:/a"] != 100 || limits["method:GET"] != 10 {
+		t.Errorf("limits enforced = %v, want path:/a at 100 and method:GET at 10", limits)
+	}
+}
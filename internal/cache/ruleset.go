@@ -0,0 +1,536 @@
+package cache
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	"github.com/pronei/nogo/internal/helpers"
+	"github.com/pronei/nogo/internal/immutables"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// ruleSet is a snapshot of every rule in a namespace. It is never modified once published
+// so readers holding on to it always see a complete version of the rules.
+type ruleSet struct {
+	version uint64
+
+	// entity type + rule key -> rule
+	rules *immutables.Map[string, structs.AttributeRule]
+
+	// compound rules are indexed by entity type and their first condition (the anchor),
+	// anchor key -> keys of the compound rules sharing it
+	anchors *immutables.Map[string, []string]
+
+	// exemption key (see exemptionKey) -> exemption
+	exemptions *immutables.Map[string, structs.Exemption]
+
+	// block key (see blockKey) -> block, the ones with patterns are indexed by entity type
+	blocks   *immutables.Map[string, structs.Block]
+	patterns *immutables.Map[string, []patternBlock]
+
+	// overrides and plans are keyed by entity type, entity or plan name and rule key (see scopedKey),
+	// and indexed by entity type + entity or plan name
+	overrides       *immutables.Map[string, scopedRule]
+	entityOverrides *immutables.Map[string, []structs.AttributeRule]
+	plans           *immutables.Map[string, scopedRule]
+	planRules       *immutables.Map[string, []structs.AttributeRule]
+	// number of plan rules of each entity type
+	planTypes *immutables.Map[string, int]
+}
+
+// scopedRule is a rule that only applies to a named entity or to the entities on a plan
+type scopedRule struct {
+	entityType string
+	scope      string
+	rule       structs.AttributeRule
+}
+
+type patternBlock struct {
+	block   structs.Block
+	pattern *regexp.Regexp
+}
+
+// draft is a mutable view of the rules that changes are applied to before it is published. It only keeps the
+// changes made on top of the snapshot it was taken from, so that neither taking a draft nor publishing it
+// copies every rule when only a few of them change.
+type draft struct {
+	base *ruleSet
+
+	rules      section[structs.AttributeRule]
+	exemptions section[structs.Exemption]
+	blocks     section[structs.Block]
+	overrides  section[scopedRule]
+	plans      section[scopedRule]
+}
+
+// section is the entries of one kind in a draft, the changes made to it are kept apart from the published entries
+type section[V any] struct {
+	published *immutables.Map[string, V]
+	// changed entries, nil for removed ones
+	changes map[string]*V
+}
+
+func newSection[V any](published *immutables.Map[string, V]) section[V] {
+	return section[V]{published: published, changes: make(map[string]*V)}
+}
+
+func (s *section[V]) get(key string) (V, bool) {
+	if changed, exists := s.changes[key]; exists {
+		if changed == nil {
+			var zero V
+			return zero, false
+		}
+		return *changed, true
+	}
+	return s.published.Get(key)
+}
+
+func (s *section[V]) set(key string, entry V) {
+	s.changes[key] = &entry
+}
+
+func (s *section[V]) delete(key string) {
+	if _, exists := s.published.Get(key); exists {
+		s.changes[key] = nil
+	} else {
+		delete(s.changes, key)
+	}
+}
+
+// entries returns every entry of the section with the changes applied
+func (s *section[V]) entries() map[string]V {
+	entries := make(map[string]V, s.published.Len()+len(s.changes))
+	s.published.Range(func(key string, entry V) bool {
+		entries[key] = entry
+		return true
+	})
+	for key, changed := range s.changes {
+		if changed == nil {
+			delete(entries, key)
+		} else {
+			entries[key] = *changed
+		}
+	}
+	return entries
+}
+
+// changed calls f for every key changed in the section with the entry it had when published and the one it has now
+func (s *section[V]) changed(f func(key string, previous, current *V)) {
+	for key, current := range s.changes {
+		var previous *V
+		if entry, exists := s.published.Get(key); exists {
+			previous = &entry
+		}
+		f(key, previous, current)
+	}
+}
+
+func newDraft() *draft {
+	empty := &ruleSet{
+		rules:           immutables.NewMap[string, structs.AttributeRule](nil),
+		anchors:         immutables.NewMap[string, []string](nil),
+		exemptions:      immutables.NewMap[string, structs.Exemption](nil),
+		blocks:          immutables.NewMap[string, structs.Block](nil),
+		patterns:        immutables.NewMap[string, []patternBlock](nil),
+		overrides:       immutables.NewMap[string, scopedRule](nil),
+		entityOverrides: immutables.NewMap[string, []structs.AttributeRule](nil),
+		plans:           immutables.NewMap[string, scopedRule](nil),
+		planRules:       immutables.NewMap[string, []structs.AttributeRule](nil),
+		planTypes:       immutables.NewMap[string, int](nil),
+	}
+	return empty.draft()
+}
+
+func (rs *ruleSet) draft() *draft {
+	return &draft{
+		base:       rs,
+		rules:      newSection(rs.rules),
+		exemptions: newSection(rs.exemptions),
+		blocks:     newSection(rs.blocks),
+		overrides:  newSection(rs.overrides),
+		plans:      newSection(rs.plans),
+	}
+}
+
+// publish turns the draft into a snapshot, the indexes are only updated where the changes made to the draft touch them
+func (d *draft) publish(version uint64) *ruleSet {
+	return &ruleSet{
+		version:         version,
+		rules:           d.rules.publish(),
+		anchors:         d.base.anchors.With(d.anchorChanges()),
+		exemptions:      d.exemptions.publish(),
+		blocks:          d.blocks.publish(),
+		patterns:        d.base.patterns.With(d.patternChanges()),
+		overrides:       d.overrides.publish(),
+		entityOverrides: d.base.entityOverrides.With(scopeChanges(&d.overrides, d.base.entityOverrides)),
+		plans:           d.plans.publish(),
+		planRules:       d.base.planRules.With(scopeChanges(&d.plans, d.base.planRules)),
+		planTypes:       d.base.planTypes.With(d.planTypeChanges()),
+	}
+}
+
+func (s *section[V]) publish() *immutables.Map[string, V] {
+	return s.published.With(s.changes)
+}
+
+// anchorKey is the key compound rules are indexed by, rules with a single condition have none
+func anchorKey(key string, rule *structs.AttributeRule) (string, bool) {
+	conditions := rule.MatchConditions()
+	if len(conditions) < 2 {
+		return "", false
+	}
+	return helpers.FormKey(helpers.ParseKey(key, 0), conditions[0].AttributeType, conditions[0].AttributeValue), true
+}
+
+// anchorChanges lists the compound rules of every anchor touched by the changes to the rules again
+func (d *draft) anchorChanges() map[string]*[]string {
+	c := newIndexChange[string]()
+	d.rules.changed(func(key string, previous, current *structs.AttributeRule) {
+		if previous != nil {
+			if anchor, exists := anchorKey(key, previous); exists {
+				c.remove(anchor, key)
+			}
+		}
+		if current != nil {
+			if anchor, exists := anchorKey(key, current); exists {
+				c.add(anchor, key, key)
+			}
+		}
+	})
+	return c.changes(d.base.anchors, func(key *string) string { return *key })
+}
+
+// patternChanges lists the pattern blocks of every entity type touched by the changes to the blocks again,
+// patterns have been validated before making it to the draft
+func (d *draft) patternChanges() map[string]*[]patternBlock {
+	c := newIndexChange[patternBlock]()
+	d.blocks.changed(func(key string, previous, current *structs.Block) {
+		if previous != nil && previous.Pattern != "" {
+			c.remove(previous.EntityType, key)
+		}
+		if current != nil && current.Pattern != "" {
+			if pattern, err := regexp.Compile("^(?:" + current.Pattern + ")$"); err == nil {
+				c.add(current.EntityType, key, patternBlock{block: *current, pattern: pattern})
+			}
+		}
+	})
+	return c.changes(d.base.patterns, func(candidate *patternBlock) string { return blockKey(&candidate.block) })
+}
+
+// scopeChanges lists the rules of every entity or plan touched by the changes to the scoped rules again
+func scopeChanges(scoped *section[scopedRule], index *immutables.Map[string, []structs.AttributeRule]) map[string]*[]structs.AttributeRule {
+	c := newIndexChange[structs.AttributeRule]()
+	scoped.changed(func(_ string, previous, current *scopedRule) {
+		if previous != nil {
+			c.remove(helpers.FormKey(previous.entityType, previous.scope), previous.rule.Key())
+		}
+		if current != nil {
+			c.add(helpers.FormKey(current.entityType, current.scope), current.rule.Key(), current.rule)
+		}
+	})
+	// the keys of rules in the same scope only differ in the rule key
+	return c.changes(index, (*structs.AttributeRule).Key)
+}
+
+// planTypeChanges counts the plan rules of every entity type touched by the changes to the plans again
+func (d *draft) planTypeChanges() map[string]*int {
+	counts := make(map[string]int)
+	d.plans.changed(func(_ string, previous, current *scopedRule) {
+		if previous != nil {
+			counts[previous.entityType]--
+		}
+		if current != nil {
+			counts[current.entityType]++
+		}
+	})
+	changes := make(map[string]*int, len(counts))
+	for entityType, change := range counts {
+		count, _ := d.base.planTypes.Get(entityType)
+		count += change
+		changes[entityType] = nil
+		if count > 0 {
+			changes[entityType] = &count
+		}
+	}
+	return changes
+}
+
+// indexChange collects how changed entries move between the keys of an index, e.g. rules between the entities they are for
+type indexChange[V any] struct {
+	// index key + key of the entry -> changed
+	changed map[string]bool
+	// index key -> the changed entries indexed under it now, none if it only lost entries
+	added map[string][]V
+}
+
+func newIndexChange[V any]() *indexChange[V] {
+	return &indexChange[V]{changed: make(map[string]bool), added: make(map[string][]V)}
+}
+
+// remove records that the entry with the key is no longer indexed under indexKey as it was published
+func (c *indexChange[V]) remove(indexKey, key string) {
+	c.changed[helpers.FormKey(indexKey, key)] = true
+	if _, exists := c.added[indexKey]; !exists {
+		c.added[indexKey] = nil
+	}
+}
+
+// add records that the entry with the key is indexed under indexKey now
+func (c *indexChange[V]) add(indexKey, key string, entry V) {
+	c.changed[helpers.FormKey(indexKey, key)] = true
+	c.added[indexKey] = append(c.added[indexKey], entry)
+}
+
+// changes lists the entries of every index key touched again, the published entries that did not change along with the
+// added ones ordered by their keys, which keyOf returns. Index keys left without entries are removed.
+func (c *indexChange[V]) changes(index *immutables.Map[string, []V], keyOf func(*V) string) map[string]*[]V {
+	changes := make(map[string]*[]V, len(c.added))
+	for indexKey, entries := range c.added {
+		published, _ := index.Get(indexKey)
+		for i := range published {
+			if !c.changed[helpers.FormKey(indexKey, keyOf(&published[i]))] {
+				entries = append(entries, published[i])
+			}
+		}
+		changes[indexKey] = nil
+		if len(entries) > 0 {
+			sort.Slice(entries, func(i, j int) bool {
+				return keyOf(&entries[i]) < keyOf(&entries[j])
+			})
+			changes[indexKey] = &entries
+		}
+	}
+	return changes
+}
+
+// apply changes the draft as per the action, the draft must be discarded on error
+func (d *draft) apply(imported *structs.RuleImport, action enums.RuleAction) error {
+	for _, entity := range imported.EntityRuleMap {
+		for _, attribute := range entity.EntityAttributes {
+			if err := d.change(helpers.FormKey(entity.EntityType, attribute.Key()), attribute, action); err != nil {
+				return err
+			}
+		}
+
+		// entity limits are only touched when the import carries one
+		if entity.EntityLimit == 0 {
+			continue
+		}
+		limitRule := entityLimitRule(&entity)
+		if err := d.change(helpers.FormKey(entity.EntityType, limitRule.Key()), limitRule, action); err != nil {
+			return err
+		}
+	}
+	for _, exemption := range imported.Exemptions {
+		if err := changeEntry(&d.exemptions, exemptionKey(&exemption), exemption, action); err != nil {
+			return err
+		}
+	}
+	for _, block := range imported.Blocks {
+		if err := changeEntry(&d.blocks, blockKey(&block), block, action); err != nil {
+			return err
+		}
+	}
+	for _, entity := range imported.Overrides {
+		if err := changeScoped(&d.overrides, entity.EntityName, &entity, action); err != nil {
+			return err
+		}
+	}
+	for _, plan := range imported.Plans {
+		if err := changeScoped(&d.plans, plan.EntityName, &plan, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changeScoped changes the rules of an entity or plan, including its entity limit if it carries one
+func changeScoped(rules *section[scopedRule], scope string, entity *structs.EntityRules, action enums.RuleAction) error {
+	attributes := entity.EntityAttributes
+	if entity.EntityLimit != 0 {
+		attributes = append(attributes[:len(attributes):len(attributes)], entityLimitRule(entity))
+	}
+	for _, rule := range attributes {
+		key := scopedKey(entity.EntityType, scope, &rule)
+		rule, err := compiled(key, rule, action)
+		if err != nil {
+			return err
+		}
+		scoped := scopedRule{entityType: entity.EntityType, scope: scope, rule: rule}
+		if err := changeEntry(rules, key, scoped, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *draft) change(key string, rule structs.AttributeRule, action enums.RuleAction) error {
+	rule, err := compiled(key, rule, action)
+	if err != nil {
+		return err
+	}
+	return changeEntry(&d.rules, key, rule, action)
+}
+
+// compiled keeps a compiled copy of the rule's schedule, leaving the one in the import untouched
+func compiled(key string, rule structs.AttributeRule, action enums.RuleAction) (structs.AttributeRule, error) {
+	if rule.Schedule != nil && action != enums.RuleDelete {
+		schedule := *rule.Schedule
+		if err := schedule.Compile(); err != nil {
+			return rule, fmt.Errorf("invalid schedule for %s - %w\n", key, err)
+		}
+		rule.Schedule = &schedule
+	}
+	return rule, nil
+}
+
+func changeEntry[V any](entries *section[V], key string, entry V, action enums.RuleAction) error {
+	switch action {
+	case enums.RuleDelete:
+		entries.delete(key)
+	case enums.RuleAdd:
+		if _, exists := entries.get(key); exists {
+			return fmt.Errorf("duplicate rule exists for %s\n", key)
+		}
+		entries.set(key, entry)
+	case enums.RuleUpdate:
+		if _, exists := entries.get(key); !exists {
+			return fmt.Errorf("cannot update key - no rule exists for %s\n", key)
+		}
+		entries.set(key, entry)
+	}
+	return nil
+}
+
+// collect drops the rules and blocks that expired by t and returns how many there were
+func (d *draft) collect(t time.Time) int {
+	removed := 0
+	for key, rule := range d.rules.entries() {
+		if rule.Expired(t) {
+			d.rules.delete(key)
+			removed++
+		}
+	}
+	for key, block := range d.blocks.entries() {
+		if !block.ActiveAt(t) {
+			d.blocks.delete(key)
+			removed++
+		}
+	}
+	for _, scoped := range []*section[scopedRule]{&d.overrides, &d.plans} {
+		for key, s := range scoped.entries() {
+			if s.rule.Expired(t) {
+				scoped.delete(key)
+				removed++
+			}
+		}
+	}
+	return removed
+}
+
+// exemptionKey is either for the entity itself or for one of its attributes
+func exemptionKey(exemption *structs.Exemption) string {
+	if exemption.EntityName != "" {
+		return helpers.FormKey(constants.NameExemption, exemption.EntityType, exemption.EntityName)
+	}
+	return helpers.FormKey(constants.AttributeExemption, exemption.EntityType, exemption.AttributeType, exemption.AttributeValue)
+}
+
+// blockKey is for a pattern, the entity itself or one of its attributes, apart from the keys of exemptions
+func blockKey(block *structs.Block) string {
+	switch {
+	case block.Pattern != "":
+		return helpers.FormKey(constants.PatternBlock, block.EntityType, block.AttributeType, block.Pattern)
+	case block.EntityName != "":
+		return helpers.FormKey(constants.NameBlock, block.EntityType, block.EntityName)
+	default:
+		return helpers.FormKey(constants.AttributeBlock, block.EntityType, block.AttributeType, block.AttributeValue)
+	}
+}
+
+func scopedKey(entityType, scope string, rule *structs.AttributeRule) string {
+	return helpers.FormKey(entityType, scope, rule.Key())
+}
+
+// entityLimitRule expresses the entity limit as an attribute rule usable by every strategy,
+// as a rate for the windowed ones and as a bucket holding the limit that refills every duration
+func entityLimitRule(entity *structs.EntityRules) structs.AttributeRule {
+	return structs.AttributeRule{
+		Description:    fmt.Sprintf("entity limit for %s", entity.EntityType),
+		AttributeType:  constants.EntityLimitAttribute,
+		AttributeValue: constants.AllAttribute,
+		Rates: []structs.Rate{
+			{Duration: entity.EntityDuration, Limit: entity.EntityLimit},
+		},
+		Bucket: structs.Bucket{
+			Duration: entity.EntityDuration,
+			Refill:   int64(entity.EntityLimit),
+			Cost:     1,
+			Maximum:  int64(entity.EntityLimit),
+		},
+	}
+}
+
+// export turns the rules back into an import that recreates them when saved, keyed by entity type
+func (d *draft) export() *structs.RuleImport {
+	imported := &structs.RuleImport{EntityRuleMap: make(map[string]structs.EntityRules)}
+	rules := d.rules.entries()
+	for _, key := range sortedKeys(rules) {
+		rule := rules[key]
+		entityType := helpers.ParseKey(key, 0)
+		entity := imported.EntityRuleMap[entityType]
+		entity.EntityType = entityType
+		addRule(&entity, rule)
+		imported.EntityRuleMap[entityType] = entity
+	}
+	exemptions := d.exemptions.entries()
+	for _, key := range sortedKeys(exemptions) {
+		imported.Exemptions = append(imported.Exemptions, exemptions[key])
+	}
+	blocks := d.blocks.entries()
+	for _, key := range sortedKeys(blocks) {
+		imported.Blocks = append(imported.Blocks, blocks[key])
+	}
+	imported.Overrides = exportScoped(d.overrides.entries())
+	imported.Plans = exportScoped(d.plans.entries())
+	return imported
+}
+
+// exportScoped groups the rules of every entity or plan, identified by its type and name like in an import
+func exportScoped(scoped map[string]scopedRule) []structs.EntityRules {
+	var exported []structs.EntityRules
+	// consecutive keys belong to the same entity or plan as the key starts with its type and name
+	for _, key := range sortedKeys(scoped) {
+		s := scoped[key]
+		last := len(exported) - 1
+		if last < 0 || exported[last].EntityType != s.entityType || exported[last].EntityName != s.scope {
+			exported = append(exported, structs.EntityRules{EntityType: s.entityType, EntityName: s.scope})
+			last++
+		}
+		addRule(&exported[last], s.rule)
+	}
+	return exported
+}
+
+// addRule adds an exported rule to its entity, the entity limit is turned back into the entity's limit and duration
+func addRule(entity *structs.EntityRules, rule structs.AttributeRule) {
+	if rule.AttributeType == constants.EntityLimitAttribute {
+		entity.EntityLimit = rule.Rates[0].Limit
+		entity.EntityDuration = rule.Rates[0].Duration
+	} else {
+		entity.EntityAttributes = append(entity.EntityAttributes, rule)
+	}
+}
+
+func sortedKeys[V any](entries map[string]V) []string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	"github.com/pronei/nogo/internal/immutables"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// indexed returns the entries of an index keyed by index key, with keyOf turning each entry into something comparable
+func indexed[V any](index *immutables.Map[string, []V], keyOf func(*V) string) map[string][]string {
+	result := make(map[string][]string)
+	index.Range(func(indexKey string, entries []V) bool {
+		for i := range entries {
+			result[indexKey] = append(result[indexKey], keyOf(&entries[i]))
+		}
+		return true
+	})
+	return result
+}
+
+func counts(index *immutables.Map[string, int]) map[string]int {
+	result := make(map[string]int)
+	index.Range(func(key string, count int) bool {
+		result[key] = count
+		return true
+	})
+	return result
+}
+
+// TestRuleSetIndexesFollowChanges saves and deletes rules one at a time and checks that the indexes updated along the way
+// are the ones built from scratch for the same rules
+func TestRuleSetIndexesFollowChanges(t *testing.T) {
+	rc := New(&structs.RateLimiterConfig{StrategyConfig: structs.StrategyConfig{Type: "rolling_window", TimeUnit: constants.Second}})
+	rate := []structs.Rate{{Duration: 60, Limit: 10}}
+	compound := func(i int) structs.AttributeRule {
+		return structs.AttributeRule{Conditions: []structs.Condition{
+			{AttributeType: "tier", AttributeValue: fmt.Sprint(i % 3)}, {AttributeType: "path", AttributeValue: fmt.Sprint(i)},
+		}, Rates: rate}
+	}
+	override := func(i int) structs.EntityRules {
+		return structs.EntityRules{EntityType: "user", EntityName: fmt.Sprint(i % 7), EntityAttributes: []structs.AttributeRule{
+			{AttributeType: "path", AttributeValue: fmt.Sprint(i), Rates: rate},
+		}}
+	}
+	block := func(i int) structs.Block {
+		return structs.Block{EntityType: fmt.Sprintf("type%d", i%2), Pattern: fmt.Sprintf("bot-%d-.*", i), Reason: "abuse"}
+	}
+	plan := func(i int) []structs.EntityRules {
+		return []structs.EntityRules{{EntityType: fmt.Sprintf("type%d", i%2), EntityName: fmt.Sprintf("plan%d", i%4), EntityAttributes: []structs.AttributeRule{
+			{AttributeType: "path", AttributeValue: fmt.Sprint(i), Rates: rate},
+		}}}
+	}
+
+	for i := range 100 {
+		imported := &structs.RuleImport{
+			EntityRuleMap: map[string]structs.EntityRules{"user": {EntityType: "user", EntityAttributes: []structs.AttributeRule{compound(i)}}},
+			Overrides:     []structs.EntityRules{override(i)},
+			Blocks:        []structs.Block{block(i)},
+			Plans:         plan(i),
+		}
+		if err := rc.SaveRules(imported, enums.RuleAdd); err != nil {
+			t.Fatalf("could not save rules - %v", err)
+		}
+	}
+	for i := 0; i < 100; i += 3 {
+		imported := &structs.RuleImport{
+			EntityRuleMap: map[string]structs.EntityRules{"user": {EntityType: "user", EntityAttributes: []structs.AttributeRule{compound(i)}}},
+			Overrides:     []structs.EntityRules{override(i)},
+			Blocks:        []structs.Block{block(i)},
+			Plans:         plan(i),
+		}
+		if err := rc.SaveRules(imported, enums.RuleDelete); err != nil {
+			t.Fatalf("could not delete rules - %v", err)
+		}
+	}
+
+	updated := rc.current.Load()
+	exported, err := rc.Export(0)
+	if err != nil {
+		t.Fatalf("could not export rules - %v", err)
+	}
+	d := newDraft()
+	if err := d.apply(exported, enums.RuleAdd); err != nil {
+		t.Fatalf("could not apply exported rules - %v", err)
+	}
+	rebuilt := d.publish(updated.version)
+
+	ruleKey := (*structs.AttributeRule).Key
+	patternKey := func(candidate *patternBlock) string {
+		return blockKey(&candidate.block) + "=" + candidate.pattern.String()
+	}
+	compoundKey := func(key *string) string { return *key }
+	for _, index := range []struct {
+		name             string
+		updated, rebuilt any
+	}{
+		{"anchors", indexed(updated.anchors, compoundKey), indexed(rebuilt.anchors, compoundKey)},
+		{"patterns", indexed(updated.patterns, patternKey), indexed(rebuilt.patterns, patternKey)},
+		{"entity overrides", indexed(updated.entityOverrides, ruleKey), indexed(rebuilt.entityOverrides, ruleKey)},
+		{"plan rules", indexed(updated.planRules, ruleKey), indexed(rebuilt.planRules, ruleKey)},
+		{"plan types", counts(updated.planTypes), counts(rebuilt.planTypes)},
+	} {
+		if !reflect.DeepEqual(index.updated, index.rebuilt) {
+			t.Errorf("%s updated with every change = %v, built from scratch = %v", index.name, index.updated, index.rebuilt)
+		}
+	}
+	if updated.overrides.Len() != rebuilt.overrides.Len() || updated.overrides.Len() != 66 {
+		t.Errorf("overrides = %d, rebuilt = %d, want 66", updated.overrides.Len(), rebuilt.overrides.Len())
+	}
+}
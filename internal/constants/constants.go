@@ -1,8 +1,13 @@
 package constants
 
+import "time"
+
 const AllEntity = "ALL"
 const AllAttribute = "ALL"
 
+// Reserved attribute type under which the entity level limit is stored, along with AllAttribute as its value
+const EntityLimitAttribute = "ENTITY_LIMIT"
+
 const NanoSecond = "ns"
 const MicroSecond = "us"
 const MilliSecond = "ms"
@@ -14,3 +19,57 @@ var ValidTimeUnits = []string{NanoSecond, MicroSecond, MilliSecond, Second, Minu
 
 // WARN - change with caution, ensure namespace separation does not use this
 const KeyDelimiter = ":"
+
+// Prefixes of exemption keys for entity names and attributes
+const NameExemption = "name"
+const AttributeExemption = "attribute"
+
+// Prefixes of block keys for entity names, attributes and patterns, kept apart from the exemption ones
+const NameBlock = "blockedName"
+const AttributeBlock = "blockedAttribute"
+const PatternBlock = "blockedPattern"
+
+// Separates the type:value pairs of a compound rule in its key
+const ConditionDelimiter = "&"
+
+// Suffix of the key of a shadow rule, keeping its state apart from an enforced rule with the same conditions
+const ShadowKey = "__shadow"
+
+// Number of previous rule versions kept around for rollbacks unless configured otherwise
+const DefaultRuleHistory = 10
+
+// Redis key under the namespace holding the shared rule set, and the suffix of the channel announcing its versions
+const RulesKey = "__rules"
+const RulesChannel = "updates"
+
+// Key under the namespace holding the plan assigned to each entity
+const PlansKey = "__plans"
+
+// Prefix of the keys under the namespace holding the receipts that can be refunded,
+// and how long a receipt is kept at most, for receipts that never expire
+const ReceiptsKey = "__receipts"
+const MaxReceiptTTL = 7 * 24 * time.Hour
+
+// Key under the namespace holding the reservations that have not been settled, and the suffix of the key ordering them by expiry
+const ReservationsKey = "__reservations"
+const ReservationsExpiry = "expiry"
+
+// Reservations are returned when they have not been settled for this long unless configured otherwise,
+// expired reservations are looked for this often and this many are returned at a time
+const DefaultReservationTimeout = 5 * time.Minute
+const ReservationSweepInterval = 10 * time.Second
+const ReservationSweepBatch = 100
+
+// Key under the namespace holding the credits of each entity
+const CreditsKey = "__credits"
+
+// Key under the namespace holding the audit log of administrative changes, and the number of its latest entries kept
+const AuditKey = "__audit"
+const AuditLogSize = 1000
+
+// Shared rules are checked for missed updates this often, and local changes retried this many times on conflicts
+const RuleSyncInterval = time.Minute
+const RuleSyncAttempts = 3
+
+// Expired rules are dropped this often
+const RuleCollectInterval = time.Minute
@@ -37,3 +37,36 @@ func GetStrategy(s string) Strategy {
 		return StrategyUnknown
 	}
 }
+
+type Evaluation string
+
+const (
+	// every matching rule is enforced
+	EvaluationAll Evaluation = "all"
+	// only the highest precedence matching rule in each group is enforced
+	EvaluationMostSpecific Evaluation = "most_specific"
+)
+
+type RuleKind string
+
+const (
+	// a rule on a single attribute type and value
+	RuleKindAttribute RuleKind = "attribute"
+	// a rule on several attribute conditions at once
+	RuleKindCompound RuleKind = "compound"
+	// the limit on an entity as a whole
+	RuleKindEntityLimit RuleKind = "entity_limit"
+	// an exemption from every limit
+	RuleKindExemption RuleKind = "exemption"
+	// a block denying every request
+	RuleKindBlock RuleKind = "block"
+)
+
+type AdminAction string
+
+const (
+	// state of an entity or some of its attributes was cleared
+	AdminStateReset AdminAction = "reset_state"
+	// credits were granted to an entity
+	AdminCreditGrant AdminAction = "grant_credits"
+)
@@ -1,7 +1,16 @@
 package immutables
 
+import "math"
+
+// A map derived from another one with With keeps the changes apart until there are at least this many of them
+const minChanges = 32
+
 type Map[K comparable, V any] struct {
 	internalMap map[K]V
+
+	// entries changed on top of the internal map by With, nil for removed ones
+	changes map[K]*V
+	length  int
 }
 
 func NewMap[K comparable, V any](m map[K]V) *Map[K, V] {
@@ -9,14 +18,56 @@ func NewMap[K comparable, V any](m map[K]V) *Map[K, V] {
 	for k, v := range m {
 		n[k] = v
 	}
-	return &Map[K, V]{n}
+	return &Map[K, V]{internalMap: n, length: len(n)}
 }
 
 func (m *Map[K, V]) Get(key K) (V, bool) {
+	if changed, exists := m.changes[key]; exists {
+		if changed == nil {
+			var zero V
+			return zero, false
+		}
+		return *changed, true
+	}
 	val, ok := m.internalMap[key]
 	return val, ok
 }
 
+// With returns a map with the changes applied on top of this one, a nil change removes the entry. The map returned
+// shares the entries of this one and only copies the changes made since they were last merged into entries of its own,
+// which happens once there are about as many as the square root of the entries. Changing a single entry thereby costs
+// O(√n) instead of O(n) for copying the whole map, while lookups stay constant.
+func (m *Map[K, V]) With(changes map[K]*V) *Map[K, V] {
+	if len(changes) == 0 {
+		return m
+	}
+	merged := make(map[K]*V, len(m.changes)+len(changes))
+	for k, v := range m.changes {
+		merged[k] = v
+	}
+	length := m.length
+	for k, v := range changes {
+		if _, exists := m.Get(k); exists {
+			length--
+		}
+		if v != nil {
+			length++
+		}
+		merged[k] = v
+	}
+
+	next := &Map[K, V]{internalMap: m.internalMap, changes: merged, length: length}
+	if len(merged) < max(minChanges, int(math.Sqrt(float64(len(m.internalMap))))) {
+		return next
+	}
+	entries := make(map[K]V, length)
+	next.Range(func(k K, v V) bool {
+		entries[k] = v
+		return true
+	})
+	return &Map[K, V]{internalMap: entries, length: length}
+}
+
 type Set[T comparable] struct {
 	internalSet map[T]struct{}
 }
@@ -33,3 +84,24 @@ func (s *Set[T]) Has(key T) bool {
 	_, ok := s.internalSet[key]
 	return ok
 }
+
+func (m *Map[K, V]) Len() int {
+	return m.length
+}
+
+// Range calls f for every entry in no particular order until it returns false
+func (m *Map[K, V]) Range(f func(key K, val V) bool) {
+	for k, v := range m.changes {
+		if v != nil && !f(k, *v) {
+			return
+		}
+	}
+	for k, v := range m.internalMap {
+		if _, changed := m.changes[k]; changed {
+			continue
+		}
+		if !f(k, v) {
+			return
+		}
+	}
+}
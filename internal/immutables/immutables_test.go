@@ -0,0 +1,59 @@
+package immutables
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func entries(m *Map[string, int]) map[string]int {
+	result := make(map[string]int)
+	m.Range(func(k string, v int) bool {
+		result[k] = v
+		return true
+	})
+	return result
+}
+
+func TestMapWith(t *testing.T) {
+	one, two := 1, 2
+	base := NewMap(map[string]int{"a": 0, "b": 0})
+	next := base.With(map[string]*int{"a": &one, "b": nil, "c": &two, "d": nil})
+
+	if want := map[string]int{"a": 1, "c": 2}; !reflect.DeepEqual(entries(next), want) || next.Len() != len(want) {
+		t.Errorf("With() = %v of length %d, want %v", entries(next), next.Len(), want)
+	}
+	if _, exists := next.Get("b"); exists {
+		t.Error("expected b to be removed")
+	}
+	if v, _ := next.Get("c"); v != 2 {
+		t.Errorf("Get(c) = %d, want 2", v)
+	}
+
+	// the map changes were made on is left as it was
+	if want := map[string]int{"a": 0, "b": 0}; !reflect.DeepEqual(entries(base), want) || base.Len() != len(want) {
+		t.Errorf("base = %v of length %d, want %v", entries(base), base.Len(), want)
+	}
+}
+
+func TestMapWithMergesChanges(t *testing.T) {
+	m := NewMap[string, int](nil)
+	want := make(map[string]int)
+	// enough single changes for them to be merged into entries of their own several times over
+	for i := range 10 * minChanges {
+		v := i
+		key := fmt.Sprintf("k%d", i%(3*minChanges))
+		m = m.With(map[string]*int{key: &v})
+		want[key] = v
+		if i%5 == 0 {
+			m = m.With(map[string]*int{key: nil})
+			delete(want, key)
+		}
+	}
+	if !reflect.DeepEqual(entries(m), want) || m.Len() != len(want) {
+		t.Errorf("map = %v of length %d, want %v", entries(m), m.Len(), want)
+	}
+	if len(m.changes) >= max(minChanges, len(m.internalMap)) {
+		t.Errorf("expected the changes to have been merged, %d are kept apart from %d entries", len(m.changes), len(m.internalMap))
+	}
+}
@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DurationPattern matches the Go duration strings accepted for the durations of rules
+const DurationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Field is a field of a struct as it is written in JSON
+type Field struct {
+	Name string
+	Type reflect.Type
+	// Duration fields take an integer in the time unit of the namespace or a Go duration string
+	Duration bool
+}
+
+// Fields lists the fields of a struct type that are read from JSON, in the order they are declared
+func Fields(t reflect.Type) []Field {
+	var fields []Field
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, Field{
+			Name:     name,
+			Type:     field.Type,
+			Duration: name == "duration" && field.Type.Kind() == reflect.Int64,
+		})
+	}
+	return fields
+}
+
+// Generate describes how the type is written in JSON as a JSON Schema, struct types are
+// defined once under $defs and referred to by name
+func Generate(t reflect.Type, id string) map[string]any {
+	g := &generator{defs: make(map[string]any)}
+	root := g.schema(t)
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["$id"] = id
+	root["$defs"] = g.defs
+	return root
+}
+
+type generator struct {
+	defs map[string]any
+}
+
+func (g *generator) schema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, exists := g.defs[t.Name()]; !exists {
+			// reserve the name first so that recursive types refer to it
+			g.defs[t.Name()] = nil
+			g.defs[t.Name()] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g *generator) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	for _, field := range Fields(t) {
+		if field.Duration {
+			properties[field.Name] = map[string]any{
+				"oneOf": []any{
+					map[string]any{"type": "integer"},
+					map[string]any{"type": "string", "pattern": DurationPattern},
+				},
+			}
+			continue
+		}
+		properties[field.Name] = g.schema(field.Type)
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
@@ -2,9 +2,12 @@ package store
 
 import (
 	"context"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/patrickmn/go-cache"
+	"github.com/pronei/nogo/internal/constants"
 	"github.com/pronei/nogo/internal/helpers"
 	structs "github.com/pronei/nogo/shared"
 )
@@ -13,18 +16,28 @@ type memoryClient struct {
 	lock   sync.Mutex
 	c      *cache.Cache
 	logger helpers.Logger
+
+	// reservations that have not been taken by ID, they are never evicted
+	reservations map[string]*structs.Reservation
+	// audit log, oldest first
+	audit []structs.AuditEntry
 }
 
 func NewMemoryClient(logger helpers.Logger, opts *structs.InMemoryConfig) StateStore {
 	internal := cache.New(opts.Expiration.ToStd(), opts.CleanupInterval.ToStd())
 	// this is helpful to offload less frequently accessed keys to a slower store
 	internal.OnEvicted(func(k string, v interface{}) {
+		// receipts run out all the time and are not state
+		if strings.HasPrefix(k, constants.ReceiptsKey+constants.KeyDelimiter) {
+			return
+		}
 		eType, eName := helpers.ParseKey(k, 0), helpers.ParseKey(k, 1)
 		logger.Info("dropping state for entity %v with type %v", eName, eType)
 	})
 	return &memoryClient{
-		c:      internal,
-		logger: logger,
+		c:            internal,
+		logger:       logger,
+		reservations: make(map[string]*structs.Reservation),
 	}
 }
 
@@ -38,7 +51,7 @@ func (mc *memoryClient) GetState(_ context.Context, req StateRequestMap) (StateM
 		attrStateMap := make(map[string]AttributeState)
 
 		for _, attrReq := range entityReq.AttributeStates {
-			attrKey := helpers.FormKey(attrReq.Key, attrReq.Value)
+			attrKey := attrReq.Key
 			stateKey := helpers.FormKey(entityKey, attrKey)
 			if val, exists := mc.c.Get(stateKey); exists {
 				attrStateMap[attrKey] = val.(AttributeState)
@@ -70,3 +83,173 @@ func (mc *memoryClient) SetState(_ context.Context, state StateMap) error {
 
 	return nil
 }
+
+func (mc *memoryClient) GetPlans(_ context.Context, entityKeys []string) (map[string]string, error) {
+	plans := make(map[string]string)
+	for _, entityKey := range entityKeys {
+		if val, exists := mc.c.Get(helpers.FormKey(constants.PlansKey, entityKey)); exists {
+			plans[entityKey] = val.(string)
+		}
+	}
+	return plans, nil
+}
+
+func (mc *memoryClient) SaveReceipts(_ context.Context, receipts []IssuedReceipt) error {
+	for _, issued := range receipts {
+		// the receipt is kept as it was saved, like it would be when serialised to Redis
+		receipt := *issued.Receipt
+		receipt.Entries = append([]structs.ReceiptEntry(nil), receipt.Entries...)
+		mc.c.Set(helpers.FormKey(constants.ReceiptsKey, receipt.ID), &receipt, issued.TTL)
+	}
+	return nil
+}
+
+func (mc *memoryClient) TakeReceipt(_ context.Context, id string) (*structs.Receipt, error) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	key := helpers.FormKey(constants.ReceiptsKey, id)
+	val, exists := mc.c.Get(key)
+	if !exists {
+		return nil, nil
+	}
+	mc.c.Delete(key)
+	return val.(*structs.Receipt), nil
+}
+
+func (mc *memoryClient) SetPlan(_ context.Context, entityKey string, plan string) error {
+	key := helpers.FormKey(constants.PlansKey, entityKey)
+	if plan == "" {
+		mc.c.Delete(key)
+		return nil
+	}
+	mc.c.Set(key, plan, cache.NoExpiration)
+	return nil
+}
+
+func (mc *memoryClient) SaveReservation(_ context.Context, reservation *structs.Reservation) error {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	// the reservation is kept as it was saved, like it would be when serialised to Redis
+	saved := *reservation
+	if reservation.Receipt != nil {
+		receipt := *reservation.Receipt
+		receipt.Entries = append([]structs.ReceiptEntry(nil), receipt.Entries...)
+		saved.Receipt = &receipt
+	}
+	mc.reservations[reservation.ID] = &saved
+	return nil
+}
+
+func (mc *memoryClient) TakeReservation(_ context.Context, id string) (*structs.Reservation, error) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	reservation := mc.reservations[id]
+	delete(mc.reservations, id)
+	return reservation, nil
+}
+
+func (mc *memoryClient) TakeExpiredReservations(_ context.Context, t time.Time, limit int) ([]*structs.Reservation, error) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	var expired []*structs.Reservation
+	for id, reservation := range mc.reservations {
+		if len(expired) == limit {
+			break
+		}
+		if reservation.ExpiresAt.Before(t) {
+			expired = append(expired, reservation)
+			delete(mc.reservations, id)
+		}
+	}
+	return expired, nil
+}
+
+func (mc *memoryClient) ClearState(_ context.Context, entityKey string, attrKeys []string) error {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	if len(attrKeys) == 0 {
+		prefix := helpers.FormKey(entityKey, "")
+		for key := range mc.c.Items() {
+			if strings.HasPrefix(key, prefix) {
+				mc.c.Delete(key)
+			}
+		}
+		return nil
+	}
+	for _, attrKey := range attrKeys {
+		mc.c.Delete(helpers.FormKey(entityKey, attrKey))
+	}
+	return nil
+}
+
+func (mc *memoryClient) AddCredits(_ context.Context, entityKey string, credits int64) (int64, error) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	balance := mc.credits(entityKey) + credits
+	mc.c.Set(helpers.FormKey(constants.CreditsKey, entityKey), balance, cache.NoExpiration)
+	return balance, nil
+}
+
+func (mc *memoryClient) GetCredits(_ context.Context, entityKeys []string) (map[string]int64, error) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	credits := make(map[string]int64)
+	for _, entityKey := range entityKeys {
+		if balance := mc.credits(entityKey); balance > 0 {
+			credits[entityKey] = balance
+		}
+	}
+	return credits, nil
+}
+
+func (mc *memoryClient) UseCredits(_ context.Context, entityKeys []string) (bool, error) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	for _, entityKey := range entityKeys {
+		if mc.credits(entityKey) < 1 {
+			return false, nil
+		}
+	}
+	for _, entityKey := range entityKeys {
+		mc.c.Set(helpers.FormKey(constants.CreditsKey, entityKey), mc.credits(entityKey)-1, cache.NoExpiration)
+	}
+	return true, nil
+}
+
+// credits of the entity, the lock has to be held
+func (mc *memoryClient) credits(entityKey string) int64 {
+	if val, exists := mc.c.Get(helpers.FormKey(constants.CreditsKey, entityKey)); exists {
+		return val.(int64)
+	}
+	return 0
+}
+
+func (mc *memoryClient) AppendAudit(_ context.Context, entry *structs.AuditEntry) error {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	mc.audit = append(mc.audit, *entry)
+	if len(mc.audit) > constants.AuditLogSize {
+		mc.audit = mc.audit[len(mc.audit)-constants.AuditLogSize:]
+	}
+	return nil
+}
+
+func (mc *memoryClient) GetAudit(_ context.Context, limit int) ([]structs.AuditEntry, error) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	var entries []structs.AuditEntry
+	for i := len(mc.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, mc.audit[i])
+	}
+	return entries, nil
+}
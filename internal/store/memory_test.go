@@ -0,0 +1,313 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/helpers"
+	structs "github.com/pronei/nogo/shared"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(...any)  {}
+func (nopLogger) Debug(...any) {}
+func (nopLogger) Error(...any) {}
+func (nopLogger) Warn(...any)  {}
+func (nopLogger) Fatal(...any) {}
+func (nopLogger) Panic(...any) {}
+
+func testMemoryClient() StateStore {
+	return NewMemoryClient(nopLogger{}, &structs.InMemoryConfig{})
+}
+
+// testRequest asks for the attribute keys of the user entity u1
+func testRequest(attrKeys ...string) StateRequestMap {
+	entityReq := EntityRequest{Type: "user", Name: "u1"}
+	for _, attrKey := range attrKeys {
+		entityReq.AttributeStates = append(entityReq.AttributeStates, AttributeRequest{Key: attrKey})
+	}
+	return StateRequestMap{helpers.FormKey("user", "u1"): entityReq}
+}
+
+func TestMemoryState(t *testing.T) {
+	ctx := context.Background()
+	mc := testMemoryClient()
+
+	stateMap, err := mc.GetState(ctx, testRequest("a", "b"))
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if len(stateMap) != 0 {
+		t.Errorf("expected no state before it is set, got %+v", stateMap)
+	}
+
+	set := StateMap{helpers.FormKey("user", "u1"): {
+		EntityType:        "user",
+		EntityName:        "u1",
+		AttributeStateMap: map[string]AttributeState{"a": {Bucket: 3, Logs: []int64{1, 2}, LastUpdated: 2}},
+	}}
+	if err = mc.SetState(ctx, set); err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+
+	// attributes without state are left out of the entity's state
+	stateMap, err = mc.GetState(ctx, testRequest("a", "b"))
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if !reflect.DeepEqual(stateMap, set) {
+		t.Errorf("GetState() = %+v, want %+v", stateMap, set)
+	}
+}
+
+func TestMemoryPlans(t *testing.T) {
+	ctx := context.Background()
+	mc := testMemoryClient()
+
+	// entities are assigned to the plans of their type, which may have the same names as those of other types
+	for entityKey, plan := range map[string]string{"user:u1": "free", "user:u2": "pro", "tenant:u1": "pro"} {
+		if err := mc.SetPlan(ctx, entityKey, plan); err != nil {
+			t.Fatalf("unexpected error - %v", err)
+		}
+	}
+	// an empty plan removes the assignment
+	if err := mc.SetPlan(ctx, "user:u2", ""); err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+
+	plans, err := mc.GetPlans(ctx, []string{"user:u1", "user:u2", "user:u3", "tenant:u1"})
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if want := map[string]string{"user:u1": "free", "tenant:u1": "pro"}; !reflect.DeepEqual(plans, want) {
+		t.Errorf("GetPlans() = %v, want %v", plans, want)
+	}
+}
+
+func TestMemoryReceipts(t *testing.T) {
+	ctx := context.Background()
+	mc := testMemoryClient()
+
+	issued := &structs.Receipt{ID: "r1", At: 10, Entries: []structs.ReceiptEntry{{EntityType: "user", EntityName: "u1", Key: "tier:free", Logs: 1}}}
+	err := mc.SaveReceipts(ctx, []IssuedReceipt{{Receipt: issued, TTL: time.Hour}, {Receipt: &structs.Receipt{ID: "r2"}, TTL: time.Millisecond}})
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	// the saved receipt does not change with the one it was saved from
+	issued.Entries[0].Logs = 100
+
+	receipt, err := mc.TakeReceipt(ctx, "r1")
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if receipt == nil || receipt.Entries[0].Logs != 1 {
+		t.Errorf("TakeReceipt(r1) = %+v, want the receipt as it was saved", receipt)
+	}
+	if receipt, _ := mc.TakeReceipt(ctx, "r1"); receipt != nil {
+		t.Errorf("r1 was taken twice, got %+v", receipt)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if receipt, _ := mc.TakeReceipt(ctx, "r2"); receipt != nil {
+		t.Errorf("r2 was taken after it ran out, got %+v", receipt)
+	}
+}
+
+func TestMemoryReservations(t *testing.T) {
+	ctx := context.Background()
+	mc := testMemoryClient()
+
+	reservation := &structs.Reservation{
+		Decision: structs.Decision{Allowed: true, Receipt: &structs.Receipt{At: 1, Entries: []structs.ReceiptEntry{{Key: "a", Logs: 2}}}},
+		ID:       "r1",
+		Estimate: 2,
+	}
+	if err := mc.SaveReservation(ctx, reservation); err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	// changes made after saving are not kept
+	reservation.Estimate = 5
+	reservation.Receipt.Entries[0].Logs = 5
+
+	taken, err := mc.TakeReservation(ctx, "r1")
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if taken == nil || taken.Estimate != 2 || taken.Receipt.Entries[0].Logs != 2 {
+		t.Errorf("TakeReservation() = %+v, want the reservation as it was saved", taken)
+	}
+
+	if taken, err = mc.TakeReservation(ctx, "r1"); err != nil || taken != nil {
+		t.Errorf("TakeReservation() of a taken reservation = %+v, %v, want nil, nil", taken, err)
+	}
+}
+
+func TestMemoryTakeExpiredReservations(t *testing.T) {
+	ctx := context.Background()
+	mc := testMemoryClient()
+
+	now := time.Now()
+	for id, expiresAt := range map[string]time.Time{"r1": now.Add(-2 * time.Minute), "r2": now.Add(-time.Minute), "r3": now.Add(time.Minute)} {
+		if err := mc.SaveReservation(ctx, &structs.Reservation{ID: id, ExpiresAt: expiresAt}); err != nil {
+			t.Fatalf("unexpected error - %v", err)
+		}
+	}
+
+	expired, err := mc.TakeExpiredReservations(ctx, now, 1)
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if len(expired) != 1 {
+		t.Fatalf("expected the limit of 1 expired reservation, got %d", len(expired))
+	}
+
+	more, err := mc.TakeExpiredReservations(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	taken := map[string]bool{}
+	for _, reservation := range append(expired, more...) {
+		taken[reservation.ID] = true
+	}
+	if want := map[string]bool{"r1": true, "r2": true}; !reflect.DeepEqual(taken, want) {
+		t.Errorf("expired reservations taken = %v, want %v", taken, want)
+	}
+
+	if reservation, _ := mc.TakeReservation(ctx, "r3"); reservation == nil {
+		t.Error("expected the reservation that has not expired to be kept")
+	}
+}
+
+func TestMemoryClearState(t *testing.T) {
+	ctx := context.Background()
+	attrState := AttributeState{Bucket: 1, LastUpdated: 1}
+	setState := func(t *testing.T, mc StateStore) {
+		t.Helper()
+		err := mc.SetState(ctx, StateMap{
+			helpers.FormKey("user", "u1"): {EntityType: "user", EntityName: "u1", AttributeStateMap: map[string]AttributeState{"a": attrState, "b": attrState}},
+			helpers.FormKey("user", "u2"): {EntityType: "user", EntityName: "u2", AttributeStateMap: map[string]AttributeState{"a": attrState}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error - %v", err)
+		}
+	}
+	request := StateRequestMap{
+		helpers.FormKey("user", "u1"): {Type: "user", Name: "u1", AttributeStates: []AttributeRequest{{Key: "a"}, {Key: "b"}}},
+		helpers.FormKey("user", "u2"): {Type: "user", Name: "u2", AttributeStates: []AttributeRequest{{Key: "a"}}},
+	}
+
+	tests := []struct {
+		name      string
+		attrKeys  []string
+		wantAttrs map[string][]string
+	}{
+		{
+			name:      "clears the attributes given",
+			attrKeys:  []string{"a"},
+			wantAttrs: map[string][]string{"user:u1": {"b"}, "user:u2": {"a"}},
+		},
+		{
+			name:      "clears every attribute of the entity when none are given",
+			wantAttrs: map[string][]string{"user:u2": {"a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := testMemoryClient()
+			setState(t, mc)
+			if err := mc.ClearState(ctx, helpers.FormKey("user", "u1"), tt.attrKeys); err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+
+			stateMap, err := mc.GetState(ctx, request)
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+			attrs := make(map[string][]string)
+			for entityKey, entityState := range stateMap {
+				for _, attrReq := range request[entityKey].AttributeStates {
+					if _, exists := entityState.AttributeStateMap[attrReq.Key]; exists {
+						attrs[entityKey] = append(attrs[entityKey], attrReq.Key)
+					}
+				}
+			}
+			if !reflect.DeepEqual(attrs, tt.wantAttrs) {
+				t.Errorf("attributes with state = %v, want %v", attrs, tt.wantAttrs)
+			}
+		})
+	}
+}
+
+func TestMemoryCredits(t *testing.T) {
+	ctx := context.Background()
+	mc := testMemoryClient()
+
+	for _, add := range []int64{2, 1} {
+		if _, err := mc.AddCredits(ctx, "user:u1", add); err != nil {
+			t.Fatalf("unexpected error - %v", err)
+		}
+	}
+	balance, err := mc.AddCredits(ctx, "user:u2", 1)
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if balance != 1 {
+		t.Errorf("AddCredits() = %d, want 1", balance)
+	}
+
+	// a credit is taken from every entity
+	if used, err := mc.UseCredits(ctx, []string{"user:u1", "user:u2"}); err != nil || !used {
+		t.Fatalf("UseCredits() = %v, %v, want true, nil", used, err)
+	}
+	// or from none of them, u2 has run out
+	if used, err := mc.UseCredits(ctx, []string{"user:u1", "user:u2"}); err != nil || used {
+		t.Fatalf("UseCredits() = %v, %v, want false, nil", used, err)
+	}
+
+	// entities without credits are left out
+	credits, err := mc.GetCredits(ctx, []string{"user:u1", "user:u2", "user:u3"})
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if want := map[string]int64{"user:u1": 2}; !reflect.DeepEqual(credits, want) {
+		t.Errorf("GetCredits() = %v, want %v", credits, want)
+	}
+}
+
+func TestMemoryAudit(t *testing.T) {
+	ctx := context.Background()
+	mc := testMemoryClient()
+
+	for i := range constants.AuditLogSize + 2 {
+		entry := &structs.AuditEntry{StateChange: structs.StateChange{EntityType: "user", EntityName: "u1", Credits: int64(i)}}
+		if err := mc.AppendAudit(ctx, entry); err != nil {
+			t.Fatalf("unexpected error - %v", err)
+		}
+	}
+
+	entries, err := mc.GetAudit(ctx, 3)
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	var credits []int64
+	for _, entry := range entries {
+		credits = append(credits, entry.Credits)
+	}
+	newest := int64(constants.AuditLogSize + 1)
+	if want := []int64{newest, newest - 1, newest - 2}; !reflect.DeepEqual(credits, want) {
+		t.Errorf("GetAudit(3) returned the entries %v, want %v", credits, want)
+	}
+
+	// only the latest entries are kept
+	if entries, _ = mc.GetAudit(ctx, constants.AuditLogSize+2); len(entries) != constants.AuditLogSize {
+		t.Errorf("expected %d entries to be kept, got %d", constants.AuditLogSize, len(entries))
+	}
+	if oldest := entries[len(entries)-1].Credits; oldest != 2 {
+		t.Errorf("oldest entry kept = %d, want 2", oldest)
+	}
+}
@@ -2,7 +2,11 @@ package store
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/pronei/nogo/internal/constants"
 	"github.com/pronei/nogo/internal/helpers"
@@ -19,6 +23,15 @@ type redisClient struct {
 }
 
 func NewRedisClient(logger helpers.Logger, opts *structs.RedisConfig, namespace string) (StateStore, error) {
+	client, err := ConnectRedis(logger, opts)
+	if err != nil {
+		return nil, err
+	}
+	return FromRedisClient(logger, client, namespace), nil
+}
+
+// ConnectRedis creates a client for the config and checks that the server is reachable
+func ConnectRedis(logger helpers.Logger, opts *structs.RedisConfig) (*redis.Client, error) {
 	db := opts.DB
 	readTimeout, _ := helpers.GetTimeInDurationWithError(opts.ReadTimeoutInMillis, constants.MilliSecond)
 	writeTimeout, _ := helpers.GetTimeInDurationWithError(opts.WriteTimeoutInMillis, constants.MilliSecond)
@@ -36,7 +49,7 @@ func NewRedisClient(logger helpers.Logger, opts *structs.RedisConfig, namespace
 		return nil, fmt.Errorf("Could not connect to Redis @ %s, DB - %d, error - %v\n", "", db, err.Error())
 	}
 	logger.Info("Connected to redis: %s\n", pong)
-	return &redisClient{client: client, keyPrefix: namespace, logger: logger}, nil
+	return client, nil
 }
 
 func FromRedisClient(logger helpers.Logger, client *redis.Client, namespace string) StateStore {
@@ -80,8 +93,7 @@ func (r *redisClient) GetState(ctx context.Context, req StateRequestMap) (StateM
 				continue
 			}
 
-			attributeReq := req[hashKey].AttributeStates[attrIdx]
-			attributeKey := helpers.FormKey(attributeReq.Key, attributeReq.Value)
+			attributeKey := req[hashKey].AttributeStates[attrIdx].Key
 			attributeState, err := getAttributeFromProtoBytes([]byte(result.(string)))
 			if err != nil {
 				return nil, fmt.Errorf("failed to parse state for attribute %s - %w\n", attributeKey, err)
@@ -129,6 +141,243 @@ func (r *redisClient) SetState(ctx context.Context, state StateMap) error {
 	return nil
 }
 
+func (r *redisClient) GetPlans(ctx context.Context, entityKeys []string) (map[string]string, error) {
+	plans := make(map[string]string)
+	if len(entityKeys) == 0 {
+		return plans, nil
+	}
+	values, err := r.client.HMGet(ctx, helpers.FormKey(r.keyPrefix, constants.PlansKey), entityKeys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plans - %w\n", err)
+	}
+	for i, value := range values {
+		if plan, ok := value.(string); ok {
+			plans[entityKeys[i]] = plan
+		}
+	}
+	return plans, nil
+}
+
+func (r *redisClient) SetPlan(ctx context.Context, entityKey string, plan string) error {
+	key := helpers.FormKey(r.keyPrefix, constants.PlansKey)
+	var err error
+	if plan == "" {
+		err = r.client.HDel(ctx, key, entityKey).Err()
+	} else {
+		err = r.client.HSet(ctx, key, entityKey, plan).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set plan for %s - %w\n", entityKey, err)
+	}
+	return nil
+}
+
+func (r *redisClient) SaveReceipts(ctx context.Context, receipts []IssuedReceipt) error {
+	if len(receipts) == 0 {
+		return nil
+	}
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, issued := range receipts {
+			b, err := json.Marshal(issued.Receipt)
+			if err != nil {
+				return fmt.Errorf("failed to marshal receipt %s - %w\n", issued.Receipt.ID, err)
+			}
+			pipe.Set(ctx, helpers.FormKey(r.keyPrefix, constants.ReceiptsKey, issued.Receipt.ID), b, issued.TTL)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save receipts - %w\n", err)
+	}
+	return nil
+}
+
+func (r *redisClient) TakeReceipt(ctx context.Context, id string) (*structs.Receipt, error) {
+	result, err := r.client.GetDel(ctx, helpers.FormKey(r.keyPrefix, constants.ReceiptsKey, id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to take receipt %s - %w\n", id, err)
+	}
+	receipt := &structs.Receipt{}
+	if err := json.Unmarshal([]byte(result), receipt); err != nil {
+		return nil, fmt.Errorf("failed to parse receipt %s - %w\n", id, err)
+	}
+	return receipt, nil
+}
+
+// takeReservationScript removes a reservation along with its expiry and returns it, nothing if it is gone already
+var takeReservationScript = redis.NewScript(`
+local reservation = redis.call('HGET', KEYS[1], ARGV[1])
+if reservation then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+	redis.call('ZREM', KEYS[2], ARGV[1])
+end
+return reservation
+`)
+
+func (r *redisClient) SaveReservation(ctx context.Context, reservation *structs.Reservation) error {
+	b, err := json.Marshal(reservation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reservation %s - %w\n", reservation.ID, err)
+	}
+	key := helpers.FormKey(r.keyPrefix, constants.ReservationsKey)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, reservation.ID, b)
+		pipe.ZAdd(ctx, helpers.FormKey(key, constants.ReservationsExpiry), redis.Z{
+			Score:  float64(reservation.ExpiresAt.UnixMilli()),
+			Member: reservation.ID,
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save reservation %s - %w\n", reservation.ID, err)
+	}
+	return nil
+}
+
+func (r *redisClient) TakeReservation(ctx context.Context, id string) (*structs.Reservation, error) {
+	key := helpers.FormKey(r.keyPrefix, constants.ReservationsKey)
+	result, err := takeReservationScript.Run(ctx, r.client, []string{key, helpers.FormKey(key, constants.ReservationsExpiry)}, id).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to take reservation %s - %w\n", id, err)
+	}
+	reservation := &structs.Reservation{}
+	if err := json.Unmarshal([]byte(result), reservation); err != nil {
+		return nil, fmt.Errorf("failed to parse reservation %s - %w\n", id, err)
+	}
+	return reservation, nil
+}
+
+func (r *redisClient) TakeExpiredReservations(ctx context.Context, t time.Time, limit int) ([]*structs.Reservation, error) {
+	ids, err := r.client.ZRangeByScore(ctx, helpers.FormKey(r.keyPrefix, constants.ReservationsKey, constants.ReservationsExpiry), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "(" + strconv.FormatInt(t.UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find expired reservations - %w\n", err)
+	}
+
+	// another instance may take some of them first
+	var expired []*structs.Reservation
+	for _, id := range ids {
+		reservation, err := r.TakeReservation(ctx, id)
+		if err != nil {
+			return expired, err
+		}
+		if reservation != nil {
+			expired = append(expired, reservation)
+		}
+	}
+	return expired, nil
+}
+
+func (r *redisClient) ClearState(ctx context.Context, entityKey string, attrKeys []string) error {
+	var err error
+	if len(attrKeys) == 0 {
+		err = r.client.Del(ctx, r.keyPrefix+entityKey).Err()
+	} else {
+		err = r.client.HDel(ctx, r.keyPrefix+entityKey, attrKeys...).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to clear state of %s - %w\n", entityKey, err)
+	}
+	return nil
+}
+
+func (r *redisClient) AddCredits(ctx context.Context, entityKey string, credits int64) (int64, error) {
+	balance, err := r.client.HIncrBy(ctx, helpers.FormKey(r.keyPrefix, constants.CreditsKey), entityKey, credits).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to add credits for %s - %w\n", entityKey, err)
+	}
+	return balance, nil
+}
+
+func (r *redisClient) GetCredits(ctx context.Context, entityKeys []string) (map[string]int64, error) {
+	credits := make(map[string]int64)
+	if len(entityKeys) == 0 {
+		return credits, nil
+	}
+	values, err := r.client.HMGet(ctx, helpers.FormKey(r.keyPrefix, constants.CreditsKey), entityKeys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credits - %w\n", err)
+	}
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		balance, err := strconv.ParseInt(value.(string), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credits %v for %s - %w\n", value, entityKeys[i], err)
+		}
+		if balance > 0 {
+			credits[entityKeys[i]] = balance
+		}
+	}
+	return credits, nil
+}
+
+// useCreditsScript takes a credit from each of the entities only if all of them have one
+var useCreditsScript = redis.NewScript(`
+for _, entity in ipairs(ARGV) do
+	if tonumber(redis.call('HGET', KEYS[1], entity) or '0') < 1 then
+		return 0
+	end
+end
+for _, entity in ipairs(ARGV) do
+	redis.call('HINCRBY', KEYS[1], entity, -1)
+end
+return 1
+`)
+
+func (r *redisClient) UseCredits(ctx context.Context, entityKeys []string) (bool, error) {
+	args := make([]interface{}, len(entityKeys))
+	for i, entityKey := range entityKeys {
+		args[i] = entityKey
+	}
+	used, err := useCreditsScript.Run(ctx, r.client, []string{helpers.FormKey(r.keyPrefix, constants.CreditsKey)}, args...).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to use credits - %w\n", err)
+	}
+	return used == 1, nil
+}
+
+func (r *redisClient) AppendAudit(ctx context.Context, entry *structs.AuditEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry - %w\n", err)
+	}
+	key := helpers.FormKey(r.keyPrefix, constants.AuditKey)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, b)
+		pipe.LTrim(ctx, key, 0, constants.AuditLogSize-1)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to append audit entry - %w\n", err)
+	}
+	return nil
+}
+
+func (r *redisClient) GetAudit(ctx context.Context, limit int) ([]structs.AuditEntry, error) {
+	values, err := r.client.LRange(ctx, helpers.FormKey(r.keyPrefix, constants.AuditKey), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log - %w\n", err)
+	}
+	entries := make([]structs.AuditEntry, len(values))
+	for i, value := range values {
+		if err := json.Unmarshal([]byte(value), &entries[i]); err != nil {
+			return nil, fmt.Errorf("failed to parse audit entry - %w\n", err)
+		}
+	}
+	return entries, nil
+}
+
 func getProtoBytesForAttribute(attribute *AttributeState, key string) ([]byte, error) {
 	bytes, err := proto.Marshal(&protobuf.AttributeState{
 		Bucket:      attribute.Bucket,
@@ -156,7 +405,7 @@ func getAttributeFromProtoBytes(b []byte) (*AttributeState, error) {
 func getAttributeKeys(entityReq *EntityRequest) []string {
 	var keys []string
 	for _, attribute := range entityReq.AttributeStates {
-		keys = append(keys, helpers.FormKey(attribute.Key, attribute.Value))
+		keys = append(keys, attribute.Key)
 	}
 	return keys
 }
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/helpers"
+	structs "github.com/pronei/nogo/shared"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrRulesConflict is returned when the rules in Redis moved past the version a change was based on
+var ErrRulesConflict = errors.New("rules were changed by another instance")
+
+// saveRulesScript only writes the rules if they are still at the expected version,
+// the version is bumped and announced on the update channel as part of the same script
+var saveRulesScript = redis.NewScript(`
+local current = tonumber(redis.call('HGET', KEYS[1], 'version') or '0')
+if current ~= tonumber(ARGV[1]) then
+	return -1
+end
+local next = current + 1
+redis.call('HSET', KEYS[1], 'version', next, 'rules', ARGV[2])
+redis.call('PUBLISH', ARGV[3], next)
+return next
+`)
+
+// RuleStore keeps the complete rule set of a namespace in Redis along with its version,
+// every change is published so that all instances sharing the namespace converge on it
+type RuleStore struct {
+	client  *redis.Client
+	key     string
+	channel string
+}
+
+func NewRuleStore(client *redis.Client, namespace string) *RuleStore {
+	return &RuleStore{
+		client:  client,
+		key:     helpers.FormKey(namespace, constants.RulesKey),
+		channel: helpers.FormKey(namespace, constants.RulesKey, constants.RulesChannel),
+	}
+}
+
+// Load returns the stored rules and their version, version 0 means nothing has been stored yet
+func (s *RuleStore) Load(ctx context.Context) (uint64, *structs.RuleImport, error) {
+	values, err := s.client.HMGet(ctx, s.key, "version", "rules").Result()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to load rules - %w\n", err)
+	}
+	if values[0] == nil || values[1] == nil {
+		return 0, nil, nil
+	}
+	version, err := strconv.ParseUint(values[0].(string), 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid rules version %v - %w\n", values[0], err)
+	}
+	rules := &structs.RuleImport{}
+	if err := json.Unmarshal([]byte(values[1].(string)), rules); err != nil {
+		return 0, nil, fmt.Errorf("failed to parse rules of version %d - %w\n", version, err)
+	}
+	return version, rules, nil
+}
+
+// Save stores the rules as the version following expected and returns it, ErrRulesConflict
+// is returned if another instance saved its rules in the meantime
+func (s *RuleStore) Save(ctx context.Context, expected uint64, rules *structs.RuleImport) (uint64, error) {
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal rules - %w\n", err)
+	}
+	next, err := saveRulesScript.Run(ctx, s.client, []string{s.key}, expected, b, s.channel).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to save rules - %w\n", err)
+	}
+	if next < 0 {
+		return 0, ErrRulesConflict
+	}
+	return uint64(next), nil
+}
+
+// Updates delivers the versions announced by any instance until the context is done,
+// it returns once the subscription is in place so that no later announcement is missed
+func (s *RuleStore) Updates(ctx context.Context) (<-chan uint64, error) {
+	pubsub := s.client.Subscribe(ctx, s.channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to rule updates - %w\n", err)
+	}
+
+	updates := make(chan uint64)
+	go func() {
+		defer close(updates)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				version, err := strconv.ParseUint(msg.Payload, 10, 64)
+				if err != nil {
+					continue
+				}
+				select {
+				case updates <- version:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return updates, nil
+}
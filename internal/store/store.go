@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/pronei/nogo/internal/helpers"
 	structs "github.com/pronei/nogo/shared"
@@ -16,8 +17,8 @@ type EntityRequest struct {
 }
 
 type AttributeRequest struct {
-	Key   string
-	Value string
+	// Key is the attribute type+value of the rule, joined for compound rules
+	Key string
 }
 
 type StateMap map[string]EntityState
@@ -34,11 +35,49 @@ type AttributeState struct {
 	LastUpdated int64   `json:"lastUpdated"`
 }
 
+// IssuedReceipt is a receipt that is kept for TTL, the time until refunding it makes no difference any more
+type IssuedReceipt struct {
+	Receipt *structs.Receipt
+	TTL     time.Duration
+}
+
 type StateStore interface {
 	// NOTE: key -> entity type+name, value -> map of attribute type+value to AttributeState
 
 	GetState(ctx context.Context, req StateRequestMap) (StateMap, error)
 	SetState(ctx context.Context, state StateMap) error
+
+	// GetPlans returns the plans assigned to the entities by entity type+name, entities without one are left out
+	GetPlans(ctx context.Context, entityKeys []string) (map[string]string, error)
+	// SetPlan assigns the entity to one of the plans of its type by the plan's name, an empty plan removes the assignment
+	SetPlan(ctx context.Context, entityKey string, plan string) error
+
+	// SaveReceipts keeps the receipts by ID until they are taken or their TTL runs out
+	SaveReceipts(ctx context.Context, receipts []IssuedReceipt) error
+	// TakeReceipt removes the receipt and returns it, nil if it has been taken before or has run out
+	TakeReceipt(ctx context.Context, id string) (*structs.Receipt, error)
+
+	// SaveReservation keeps the reservation until it is taken
+	SaveReservation(ctx context.Context, reservation *structs.Reservation) error
+	// TakeReservation removes the reservation and returns it, nil if it has been taken before
+	TakeReservation(ctx context.Context, id string) (*structs.Reservation, error)
+	// TakeExpiredReservations removes up to limit reservations that expired before t and returns them
+	TakeExpiredReservations(ctx context.Context, t time.Time, limit int) ([]*structs.Reservation, error)
+
+	// ClearState removes the state of the entity's attributes, all of them when none are given
+	ClearState(ctx context.Context, entityKey string, attrKeys []string) error
+
+	// AddCredits adds to the credits of the entity and returns how many it has
+	AddCredits(ctx context.Context, entityKey string, credits int64) (int64, error)
+	// GetCredits returns the credits of the entities, entities without any are left out
+	GetCredits(ctx context.Context, entityKeys []string) (map[string]int64, error)
+	// UseCredits takes a credit from each of the entities if all of them have one and reports whether it did
+	UseCredits(ctx context.Context, entityKeys []string) (bool, error)
+
+	// AppendAudit adds the entry to the audit log, which keeps the latest constants.AuditLogSize entries
+	AppendAudit(ctx context.Context, entry *structs.AuditEntry) error
+	// GetAudit returns up to limit of the latest entries in the audit log, newest first
+	GetAudit(ctx context.Context, limit int) ([]structs.AuditEntry, error)
 }
 
 func CreateStateRequest(rules map[string]structs.EntityRules) StateRequestMap {
@@ -50,8 +89,7 @@ func CreateStateRequest(rules map[string]structs.EntityRules) StateRequestMap {
 		attrStates := make([]AttributeRequest, len(entity.EntityAttributes))
 		for i, rule := range entity.EntityAttributes {
 			attrStates[i] = AttributeRequest{
-				Key:   rule.AttributeType,
-				Value: rule.AttributeValue,
+				Key: rule.Key(),
 			}
 		}
 		reqMap[helpers.FormKey(entityType, entityName)] = EntityRequest{
@@ -62,3 +100,25 @@ func CreateStateRequest(rules map[string]structs.EntityRules) StateRequestMap {
 	}
 	return reqMap
 }
+
+// MergeStateRequests adds the entities and attributes of from to into, attributes already requested are left out
+func MergeStateRequests(into, from StateRequestMap) {
+	for entityKey, entityReq := range from {
+		existing, exists := into[entityKey]
+		if !exists {
+			into[entityKey] = entityReq
+			continue
+		}
+		requested := make(map[string]struct{}, len(existing.AttributeStates))
+		for _, attrReq := range existing.AttributeStates {
+			requested[attrReq.Key] = struct{}{}
+		}
+		for _, attrReq := range entityReq.AttributeStates {
+			if _, exists := requested[attrReq.Key]; !exists {
+				existing.AttributeStates = append(existing.AttributeStates, attrReq)
+				requested[attrReq.Key] = struct{}{}
+			}
+		}
+		into[entityKey] = existing
+	}
+}
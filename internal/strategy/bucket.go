@@ -20,11 +20,7 @@ func getFixedBucket(unitDispatch func(time.Time) int64) Limiter {
 func (l *FixedBucket) Allowed(ruleMap map[string]structs.EntityRules, stateMap store.StateMap) (bool, error) {
 	currentTime := l.unitWrapper(time.Now())
 	allow, err := evaluate(ruleMap, stateMap, func(attrRule *structs.AttributeRule, attrState *store.AttributeState) bool {
-		tokens := attrState.Bucket
-		bucketRule := attrRule.Bucket
-		tokensToAdd := int64(math.Round(float64(bucketRule.Refill) * (float64(currentTime-attrState.LastUpdated) / float64(bucketRule.Duration))))
-		tokens = min(bucketRule.Maximum, tokens+tokensToAdd)
-		return tokens-bucketRule.Cost >= 0
+		return refilledTokens(&attrRule.Bucket, attrState, currentTime)-attrRule.Bucket.Cost >= 0
 	})
 	if err != nil {
 		return false, fmt.Errorf("could not evaluate - %w\n", err)
@@ -33,10 +29,70 @@ func (l *FixedBucket) Allowed(ruleMap map[string]structs.EntityRules, stateMap s
 }
 
 func (l *FixedBucket) UpdateState(ruleMap map[string]structs.EntityRules, stateMap store.StateMap) error {
+	_, err := l.Consume(ruleMap, stateMap, 1)
+	return err
+}
+
+func (l *FixedBucket) Grantable(ruleMap map[string]structs.EntityRules, stateMap store.StateMap, n int64) (int64, int64, error) {
+	currentTime := l.unitWrapper(time.Now())
+	return grantable(ruleMap, stateMap, n, func(attrRule *structs.AttributeRule, attrState *store.AttributeState, n int64) (int64, int64) {
+		bucketRule := &attrRule.Bucket
+		tokens := refilledTokens(bucketRule, attrState, currentTime)
+		granted := min(n, max(tokens/bucketRule.Cost, 0))
+		left := tokens - granted*bucketRule.Cost
+		if left >= bucketRule.Cost {
+			return granted, 0
+		}
+		if bucketRule.Refill <= 0 || bucketRule.Cost > bucketRule.Maximum {
+			return granted, -1
+		}
+		// refills are rounded to the nearest token, so the missing ones are in the bucket half a token early
+		missing := float64(bucketRule.Cost-left) - 0.5
+		return granted, int64(math.Ceil(missing * float64(bucketRule.Duration) / float64(bucketRule.Refill)))
+	})
+}
+
+func (l *FixedBucket) Inspect(ruleMap map[string]structs.EntityRules, stateMap store.StateMap) ([]Usage, error) {
+	currentTime := l.unitWrapper(time.Now())
+	return inspect(ruleMap, stateMap, func(attrRule *structs.AttributeRule, attrState *store.AttributeState) []Usage {
+		bucketRule := &attrRule.Bucket
+		tokens := refilledTokens(bucketRule, attrState, currentTime)
+		usage := Usage{Rate: -1, Limit: bucketRule.Maximum, Used: bucketRule.Maximum - tokens, ResetAt: currentTime}
+		if usage.Used > 0 {
+			// the bucket is full again once the missing tokens have been refilled
+			usage.ResetAt = -1
+			if bucketRule.Refill > 0 {
+				missing := float64(usage.Used) - 0.5
+				usage.ResetAt = currentTime + int64(math.Ceil(missing*float64(bucketRule.Duration)/float64(bucketRule.Refill)))
+			}
+		}
+		return []Usage{usage}
+	})
+}
+
+func (l *FixedBucket) Consume(ruleMap map[string]structs.EntityRules, stateMap store.StateMap, units int64) (*structs.Receipt, error) {
 	currentTime := l.unitWrapper(time.Now())
-	return changeState(ruleMap, stateMap, func(attrRule *structs.AttributeRule, attrState *store.AttributeState) error {
-		attrState.Bucket -= attrRule.Bucket.Cost
+	err := changeState(ruleMap, stateMap, func(attrRule *structs.AttributeRule, attrState *store.AttributeState) error {
+		attrState.Bucket = refilledTokens(&attrRule.Bucket, attrState, currentTime) - units*attrRule.Bucket.Cost
 		attrState.LastUpdated = currentTime
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return receiptFor(ruleMap, currentTime, func(attrRule *structs.AttributeRule) (int64, int64, int64) {
+		// the tokens make no difference once an empty bucket would have been refilled completely
+		bucketRule := &attrRule.Bucket
+		if bucketRule.Refill <= 0 {
+			return 0, units * bucketRule.Cost, 0
+		}
+		refill := int64(math.Ceil(float64(bucketRule.Maximum) * float64(bucketRule.Duration) / float64(bucketRule.Refill)))
+		return 0, units * bucketRule.Cost, currentTime + refill
+	}), nil
+}
+
+// refilledTokens is the number of tokens in the bucket at currentTime, counting the refills since it was last updated
+func refilledTokens(bucketRule *structs.Bucket, attrState *store.AttributeState, currentTime int64) int64 {
+	tokensToAdd := int64(math.Round(float64(bucketRule.Refill) * (float64(currentTime-attrState.LastUpdated) / float64(bucketRule.Duration))))
+	return min(bucketRule.Maximum, attrState.Bucket+tokensToAdd)
 }
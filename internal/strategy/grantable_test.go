@@ -0,0 +1,199 @@
+package strategy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pronei/nogo/internal/helpers"
+	"github.com/pronei/nogo/internal/store"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// at is a time unit dispatcher for a clock stopped at currentTime
+func at(currentTime int64) func(time.Time) int64 {
+	return func(time.Time) int64 { return currentTime }
+}
+
+func TestGrantable(t *testing.T) {
+	window := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Rates: []structs.Rate{{Duration: 60, Limit: 5}}}
+	bucket := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Bucket: structs.Bucket{Duration: 10, Refill: 5, Cost: 2, Maximum: 10}}
+	noRefill := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Bucket: structs.Bucket{Duration: 10, Refill: 0, Cost: 2, Maximum: 10}}
+
+	tests := []struct {
+		name        string
+		limiter     Limiter
+		rule        structs.AttributeRule
+		state       store.AttributeState
+		n           int64
+		wantGranted int64
+		wantWait    int64
+	}{
+		{
+			name:    "rolling window grants everything without state",
+			limiter: getSlidingWindow(at(1000)), rule: window, n: 3,
+			wantGranted: 3, wantWait: 0,
+		},
+		{
+			name:    "rolling window ignores logs that have dropped out",
+			limiter: getSlidingWindow(at(1000)), rule: window, state: store.AttributeState{Logs: []int64{900, 939}}, n: 5,
+			wantGranted: 5, wantWait: 0,
+		},
+		{
+			name:    "rolling window waits for the oldest log keeping it full",
+			limiter: getSlidingWindow(at(1000)), rule: window, state: store.AttributeState{Logs: []int64{950, 960, 970}}, n: 5,
+			wantGranted: 2, wantWait: 11,
+		},
+		{
+			name:    "rolling window grants nothing when full",
+			limiter: getSlidingWindow(at(1000)), rule: window, state: store.AttributeState{Logs: []int64{941, 942, 943, 944, 945}}, n: 1,
+			wantGranted: 0, wantWait: 2,
+		},
+		{
+			name:    "rolling window with a limit of zero never grants",
+			limiter: getSlidingWindow(at(1000)), rule: structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Rates: []structs.Rate{{Duration: 60, Limit: 0}}}, n: 1,
+			wantGranted: 0, wantWait: -1,
+		},
+		{
+			name:    "rolling window is bound by its strictest rate",
+			limiter: getSlidingWindow(at(1000)),
+			rule: structs.AttributeRule{AttributeType: "path", AttributeValue: "/a",
+				Rates: []structs.Rate{{Duration: 10, Limit: 2}, {Duration: 60, Limit: 5}}},
+			state: store.AttributeState{Logs: []int64{950, 995}}, n: 5,
+			wantGranted: 1, wantWait: 6,
+		},
+		{
+			name:    "static window counts the current window only",
+			limiter: getStaticWindow(at(1000)), rule: window, state: store.AttributeState{Logs: []int64{950, 965, 970}}, n: 2,
+			wantGranted: 2, wantWait: 0,
+		},
+		{
+			name:    "static window waits for the next window",
+			limiter: getStaticWindow(at(1000)), rule: window, state: store.AttributeState{Logs: []int64{950, 965, 970}}, n: 5,
+			wantGranted: 3, wantWait: 20,
+		},
+		{
+			name:    "fixed bucket grants from the tokens left",
+			limiter: getFixedBucket(at(1000)), rule: bucket, state: store.AttributeState{Bucket: 10, LastUpdated: 1000}, n: 3,
+			wantGranted: 3, wantWait: 0,
+		},
+		{
+			name:    "fixed bucket waits for the missing tokens",
+			limiter: getFixedBucket(at(1000)), rule: bucket, state: store.AttributeState{Bucket: 3, LastUpdated: 1000}, n: 3,
+			wantGranted: 1, wantWait: 1,
+		},
+		{
+			name:    "fixed bucket without state is full",
+			limiter: getFixedBucket(at(1000)), rule: bucket, n: 10,
+			wantGranted: 5, wantWait: 3,
+		},
+		{
+			name:    "fixed bucket without refills never grants more",
+			limiter: getFixedBucket(at(1000)), rule: noRefill, state: store.AttributeState{Bucket: 1, LastUpdated: 1000}, n: 1,
+			wantGranted: 0, wantWait: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			granted, wait, err := tt.limiter.Grantable(testRules(tt.rule), testState(tt.rule, tt.state), tt.n)
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+			if granted != tt.wantGranted || wait != tt.wantWait {
+				t.Errorf("Grantable(%d) = %d, %d, want %d, %d", tt.n, granted, wait, tt.wantGranted, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestGrantableRejectsMismatchedState(t *testing.T) {
+	rule := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Rates: []structs.Rate{{Duration: 60, Limit: 5}}}
+	state := store.StateMap{helpers.FormKey("user", "u1"): {EntityType: "user", EntityName: "u2"}}
+	if _, _, err := getSlidingWindow(at(1000)).Grantable(testRules(rule), state, 1); err == nil {
+		t.Error("expected an error for state of another entity")
+	}
+}
+
+func TestConsume(t *testing.T) {
+	window := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Rates: []structs.Rate{{Duration: 60, Limit: 5}}}
+	bucket := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Bucket: structs.Bucket{Duration: 10, Refill: 5, Cost: 2, Maximum: 10}}
+	noRefill := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Bucket: structs.Bucket{Duration: 10, Refill: 0, Cost: 2, Maximum: 10}}
+
+	tests := []struct {
+		name          string
+		limiter       Limiter
+		rule          structs.AttributeRule
+		state         store.AttributeState
+		units         int64
+		wantState     store.AttributeState
+		wantEntry     structs.ReceiptEntry
+		wantExpiresAt int64
+	}{
+		{
+			name:    "rolling window logs the units and purges old logs",
+			limiter: getSlidingWindow(at(1000)), rule: window, state: store.AttributeState{Logs: []int64{900, 950}}, units: 2,
+			wantState:     store.AttributeState{Logs: []int64{950, 1000, 1000}, LastUpdated: 1000},
+			wantEntry:     structs.ReceiptEntry{Logs: 2},
+			wantExpiresAt: 1061,
+		},
+		{
+			name:    "static window purges logs of past windows",
+			limiter: getStaticWindow(at(1000)), rule: window, state: store.AttributeState{Logs: []int64{950, 965}}, units: 1,
+			wantState:     store.AttributeState{Logs: []int64{965, 1000}, LastUpdated: 1000},
+			wantEntry:     structs.ReceiptEntry{Logs: 1},
+			wantExpiresAt: 1020,
+		},
+		{
+			name:    "fixed bucket takes the cost of the units",
+			limiter: getFixedBucket(at(1000)), rule: bucket, state: store.AttributeState{Bucket: 4, LastUpdated: 998}, units: 2,
+			wantState:     store.AttributeState{Bucket: 1, LastUpdated: 1000},
+			wantEntry:     structs.ReceiptEntry{Tokens: 4, Maximum: 10},
+			wantExpiresAt: 1020,
+		},
+		{
+			name:    "fixed bucket without refills never expires",
+			limiter: getFixedBucket(at(1000)), rule: noRefill, state: store.AttributeState{Bucket: 10, LastUpdated: 1000}, units: 1,
+			wantState:     store.AttributeState{Bucket: 8, LastUpdated: 1000},
+			wantEntry:     structs.ReceiptEntry{Tokens: 2, Maximum: 10},
+			wantExpiresAt: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := testState(tt.rule, tt.state)
+			receipt, err := tt.limiter.Consume(testRules(tt.rule), state, tt.units)
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+
+			got := state[helpers.FormKey("user", "u1")].AttributeStateMap[tt.rule.Key()]
+			if !reflect.DeepEqual(got, tt.wantState) {
+				t.Errorf("state = %+v, want %+v", got, tt.wantState)
+			}
+
+			tt.wantEntry.EntityType, tt.wantEntry.EntityName, tt.wantEntry.Key = "user", "u1", tt.rule.Key()
+			want := &structs.Receipt{At: 1000, ExpiresAt: tt.wantExpiresAt, Entries: []structs.ReceiptEntry{tt.wantEntry}}
+			if !reflect.DeepEqual(receipt, want) {
+				t.Errorf("receipt = %+v, want %+v", receipt, want)
+			}
+		})
+	}
+}
+
+func TestConsumeWithoutState(t *testing.T) {
+	rule := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Rates: []structs.Rate{{Duration: 60, Limit: 5}}}
+	state := store.StateMap{}
+	if _, err := getSlidingWindow(at(1000)).Consume(testRules(rule), state, 1); err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+
+	entityState, exists := state[helpers.FormKey("user", "u1")]
+	if !exists || entityState.EntityType != "user" || entityState.EntityName != "u1" {
+		t.Fatalf("expected state to be created for user:u1, got %+v", state)
+	}
+	if logs := entityState.AttributeStateMap[rule.Key()].Logs; !reflect.DeepEqual(logs, []int64{1000}) {
+		t.Errorf("logs = %v, want [1000]", logs)
+	}
+}
@@ -0,0 +1,83 @@
+package strategy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pronei/nogo/internal/store"
+	structs "github.com/pronei/nogo/shared"
+)
+
+func TestInspect(t *testing.T) {
+	window := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Rates: []structs.Rate{{Duration: 60, Limit: 5}}}
+	twoRates := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Rates: []structs.Rate{{Duration: 10, Limit: 2}, {Duration: 60, Limit: 5}}}
+	bucket := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Bucket: structs.Bucket{Duration: 10, Refill: 5, Cost: 2, Maximum: 10}}
+	noRefill := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Bucket: structs.Bucket{Duration: 10, Refill: 0, Cost: 2, Maximum: 10}}
+
+	tests := []struct {
+		name    string
+		limiter Limiter
+		rule    structs.AttributeRule
+		state   store.AttributeState
+		want    []Usage
+	}{
+		{
+			name:    "rolling window without state has nothing used",
+			limiter: getSlidingWindow(at(1000)), rule: twoRates,
+			want: []Usage{{Rate: 0, Limit: 2, Used: 0, ResetAt: 1000}, {Rate: 1, Limit: 5, Used: 0, ResetAt: 1000}},
+		},
+		{
+			name:    "rolling window resets once the newest log of every rate drops out",
+			limiter: getSlidingWindow(at(1000)), rule: twoRates, state: store.AttributeState{Logs: []int64{930, 950, 995}},
+			want: []Usage{{Rate: 0, Limit: 2, Used: 1, ResetAt: 1006}, {Rate: 1, Limit: 5, Used: 2, ResetAt: 1056}},
+		},
+		{
+			name:    "static window resets when the next window starts",
+			limiter: getStaticWindow(at(1000)), rule: window, state: store.AttributeState{Logs: []int64{950, 965}},
+			want: []Usage{{Rate: 0, Limit: 5, Used: 1, ResetAt: 1020}},
+		},
+		{
+			name:    "fixed bucket without state is full",
+			limiter: getFixedBucket(at(1000)), rule: bucket,
+			want: []Usage{{Rate: -1, Limit: 10, Used: 0, ResetAt: 1000}},
+		},
+		{
+			name:    "fixed bucket resets once the missing tokens are refilled",
+			limiter: getFixedBucket(at(1000)), rule: bucket, state: store.AttributeState{Bucket: 4, LastUpdated: 1000},
+			want: []Usage{{Rate: -1, Limit: 10, Used: 6, ResetAt: 1011}},
+		},
+		{
+			name:    "fixed bucket without refills never resets",
+			limiter: getFixedBucket(at(1000)), rule: noRefill, state: store.AttributeState{Bucket: 8, LastUpdated: 900},
+			want: []Usage{{Rate: -1, Limit: 10, Used: 2, ResetAt: -1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, err := tt.limiter.Inspect(testRules(tt.rule), testState(tt.rule, tt.state))
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+			for i := range tt.want {
+				tt.want[i].EntityType, tt.want[i].EntityName, tt.want[i].Rule = "user", "u1", tt.rule
+			}
+			if !reflect.DeepEqual(usage, tt.want) {
+				t.Errorf("Inspect() = %+v, want %+v", usage, tt.want)
+			}
+		})
+	}
+}
+
+func TestInspectDoesNotChangeState(t *testing.T) {
+	rule := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Bucket: structs.Bucket{Duration: 10, Refill: 5, Cost: 2, Maximum: 10}}
+	state := testState(rule, store.AttributeState{Bucket: 4, LastUpdated: 990})
+	want := testState(rule, store.AttributeState{Bucket: 4, LastUpdated: 990})
+
+	if _, err := getFixedBucket(at(1000)).Inspect(testRules(rule), state); err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("state = %+v, want %+v", state, want)
+	}
+}
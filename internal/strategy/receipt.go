@@ -0,0 +1,71 @@
+package strategy
+
+import (
+	"github.com/pronei/nogo/internal/helpers"
+	"github.com/pronei/nogo/internal/store"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// receiptFor lists what was consumed at currentTime from the state of every rule in the rule map. consumed returns
+// the logs and tokens taken for a rule, and when refunding them stops making a difference, 0 if it never does.
+func receiptFor(ruleMap map[string]structs.EntityRules, currentTime int64,
+	consumed func(*structs.AttributeRule) (logs int64, tokens int64, expiresAt int64)) *structs.Receipt {
+
+	receipt := &structs.Receipt{At: currentTime}
+	expires := true
+	for _, entityRule := range ruleMap {
+		for _, attrRule := range entityRule.EntityAttributes {
+			logs, tokens, expiresAt := consumed(&attrRule)
+			entry := structs.ReceiptEntry{
+				EntityType: entityRule.EntityType,
+				EntityName: entityRule.EntityName,
+				Key:        attrRule.Key(),
+				Logs:       logs,
+				Tokens:     tokens,
+			}
+			if tokens != 0 {
+				entry.Maximum = attrRule.Bucket.Maximum
+			}
+			receipt.Entries = append(receipt.Entries, entry)
+			expires = expires && expiresAt != 0
+			receipt.ExpiresAt = max(receipt.ExpiresAt, expiresAt)
+		}
+	}
+	if !expires {
+		receipt.ExpiresAt = 0
+	}
+	return receipt
+}
+
+// Refund takes what the receipt consumed back out of the state and returns the keys of the entities it changed.
+// Logs that were purged since have dropped out of every window already and are left alone, and buckets are not
+// refilled beyond their maximum.
+func Refund(stateMap store.StateMap, receipt *structs.Receipt) map[string]struct{} {
+	updated := make(map[string]struct{})
+	for _, entry := range receipt.Entries {
+		entityKey := helpers.FormKey(entry.EntityType, entry.EntityName)
+		entityState, exists := stateMap[entityKey]
+		if !exists {
+			continue
+		}
+		attrState, exists := entityState.AttributeStateMap[entry.Key]
+		if !exists {
+			continue
+		}
+
+		// logs are sorted, the ones of the receipt are among those logged at the same time
+		start := findWindowStartIndex(attrState.Logs, receipt.At)
+		end := start
+		for end < len(attrState.Logs) && attrState.Logs[end] == receipt.At && int64(end-start) < entry.Logs {
+			end++
+		}
+		attrState.Logs = append(attrState.Logs[:start:start], attrState.Logs[end:]...)
+		if entry.Tokens != 0 {
+			attrState.Bucket = min(attrState.Bucket+entry.Tokens, entry.Maximum)
+		}
+
+		entityState.AttributeStateMap[entry.Key] = attrState
+		updated[entityKey] = struct{}{}
+	}
+	return updated
+}
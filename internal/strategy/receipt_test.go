@@ -0,0 +1,122 @@
+package strategy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pronei/nogo/internal/helpers"
+	"github.com/pronei/nogo/internal/store"
+	structs "github.com/pronei/nogo/shared"
+)
+
+func TestRefundRestoresState(t *testing.T) {
+	window := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Rates: []structs.Rate{{Duration: 60, Limit: 5}}}
+	bucket := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Bucket: structs.Bucket{Duration: 10, Refill: 5, Cost: 2, Maximum: 10}}
+
+	tests := []struct {
+		name    string
+		limiter Limiter
+		rule    structs.AttributeRule
+		state   store.AttributeState
+		want    store.AttributeState
+	}{
+		{
+			name:    "rolling window",
+			limiter: getSlidingWindow(at(1000)), rule: window, state: store.AttributeState{Logs: []int64{950}},
+			want: store.AttributeState{Logs: []int64{950}, LastUpdated: 1000},
+		},
+		{
+			name:    "static window",
+			limiter: getStaticWindow(at(1000)), rule: window, state: store.AttributeState{Logs: []int64{965}},
+			want: store.AttributeState{Logs: []int64{965}, LastUpdated: 1000},
+		},
+		{
+			name:    "fixed bucket",
+			limiter: getFixedBucket(at(1000)), rule: bucket, state: store.AttributeState{Bucket: 8, LastUpdated: 1000},
+			want: store.AttributeState{Bucket: 8, LastUpdated: 1000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := testState(tt.rule, tt.state)
+			receipt, err := tt.limiter.Consume(testRules(tt.rule), state, 3)
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+
+			updated := Refund(state, receipt)
+			if _, exists := updated[helpers.FormKey("user", "u1")]; !exists || len(updated) != 1 {
+				t.Errorf("updated = %v, want user:u1 only", updated)
+			}
+			if got := state[helpers.FormKey("user", "u1")].AttributeStateMap[tt.rule.Key()]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("state after refund = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefund(t *testing.T) {
+	rule := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Rates: []structs.Rate{{Duration: 60, Limit: 5}}}
+	entityKey := helpers.FormKey("user", "u1")
+	receipt := func(logs int64) *structs.Receipt {
+		return &structs.Receipt{At: 1000, Entries: []structs.ReceiptEntry{{EntityType: "user", EntityName: "u1", Key: rule.Key(), Logs: logs}}}
+	}
+
+	tests := []struct {
+		name        string
+		state       store.StateMap
+		receipt     *structs.Receipt
+		wantLogs    []int64
+		wantUpdated bool
+	}{
+		{
+			name:     "only takes out as many logs as the receipt consumed",
+			state:    testState(rule, store.AttributeState{Logs: []int64{990, 1000, 1000, 1000, 1010}}),
+			receipt:  receipt(2),
+			wantLogs: []int64{990, 1000, 1010}, wantUpdated: true,
+		},
+		{
+			name:     "leaves logs of other times alone once the receipt's were purged",
+			state:    testState(rule, store.AttributeState{Logs: []int64{1010, 1020}}),
+			receipt:  receipt(2),
+			wantLogs: []int64{1010, 1020}, wantUpdated: true,
+		},
+		{
+			name:    "skips entities without state",
+			state:   store.StateMap{},
+			receipt: receipt(1),
+		},
+		{
+			name:    "skips rules without state",
+			state:   store.StateMap{entityKey: {EntityType: "user", EntityName: "u1", AttributeStateMap: map[string]store.AttributeState{}}},
+			receipt: receipt(1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := Refund(tt.state, tt.receipt)
+			if _, exists := updated[entityKey]; exists != tt.wantUpdated {
+				t.Errorf("updated = %v, want user:u1 updated %v", updated, tt.wantUpdated)
+			}
+			if !tt.wantUpdated {
+				return
+			}
+			if logs := tt.state[entityKey].AttributeStateMap[rule.Key()].Logs; !reflect.DeepEqual(logs, tt.wantLogs) {
+				t.Errorf("logs = %v, want %v", logs, tt.wantLogs)
+			}
+		})
+	}
+}
+
+func TestRefundDoesNotOverfillBuckets(t *testing.T) {
+	rule := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Bucket: structs.Bucket{Duration: 10, Refill: 5, Cost: 2, Maximum: 10}}
+	state := testState(rule, store.AttributeState{Bucket: 9, LastUpdated: 1000})
+	receipt := &structs.Receipt{At: 1000, Entries: []structs.ReceiptEntry{{EntityType: "user", EntityName: "u1", Key: rule.Key(), Tokens: 4, Maximum: 10}}}
+
+	Refund(state, receipt)
+	if got := state[helpers.FormKey("user", "u1")].AttributeStateMap[rule.Key()].Bucket; got != 10 {
+		t.Errorf("bucket after refund = %d, want the maximum of 10", got)
+	}
+}
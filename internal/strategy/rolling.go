@@ -37,17 +37,54 @@ func (l *SlidingWindow) Allowed(ruleMap map[string]structs.EntityRules, stateMap
 }
 
 func (l *SlidingWindow) UpdateState(ruleMap map[string]structs.EntityRules, stateMap store.StateMap) error {
+	_, err := l.Consume(ruleMap, stateMap, 1)
+	return err
+}
+
+func (l *SlidingWindow) Grantable(ruleMap map[string]structs.EntityRules, stateMap store.StateMap, n int64) (int64, int64, error) {
+	currentTime := l.unitWrapper(time.Now())
+	return grantable(ruleMap, stateMap, n, func(attrRule *structs.AttributeRule, attrState *store.AttributeState, n int64) (int64, int64) {
+		return grantableFromLogs(attrRule, attrState, n, func(rate *structs.Rate) int64 {
+			return currentTime - rate.Duration
+		}, func(rate *structs.Rate, windowLogs []int64, granted int64) int64 {
+			// the next unit is allowed once the oldest log keeping the window full drops out of it,
+			// the granted units are logged at the current time after the ones in the window
+			oldest := currentTime
+			if idx := int64(len(windowLogs)) + granted - int64(rate.Limit); idx < int64(len(windowLogs)) {
+				oldest = windowLogs[idx]
+			}
+			return oldest + rate.Duration + 1 - currentTime
+		})
+	})
+}
+
+func (l *SlidingWindow) Inspect(ruleMap map[string]structs.EntityRules, stateMap store.StateMap) ([]Usage, error) {
 	currentTime := l.unitWrapper(time.Now())
-	return changeState(ruleMap, stateMap, func(attrRule *structs.AttributeRule, attrState *store.AttributeState) error {
+	return inspect(ruleMap, stateMap, func(attrRule *structs.AttributeRule, attrState *store.AttributeState) []Usage {
+		return usageOfLogs(attrRule, attrState, currentTime, func(rate *structs.Rate) int64 {
+			return currentTime - rate.Duration
+		}, func(rate *structs.Rate, windowLogs []int64) int64 {
+			// every log has dropped out once the newest one has
+			return windowLogs[len(windowLogs)-1] + rate.Duration + 1
+		})
+	})
+}
+
+func (l *SlidingWindow) Consume(ruleMap map[string]structs.EntityRules, stateMap store.StateMap, units int64) (*structs.Receipt, error) {
+	currentTime := l.unitWrapper(time.Now())
+	err := changeState(ruleMap, stateMap, func(attrRule *structs.AttributeRule, attrState *store.AttributeState) error {
 		// purge logs older than maximum of all subRule durations
-		var windowSize int64
-		for _, rate := range attrRule.Rates {
-			windowSize = max(windowSize, rate.Duration)
-		}
-		windowStart := currentTime - windowSize
+		windowStart := currentTime - longestWindow(attrRule)
 		idx := findWindowStartIndex(attrState.Logs, windowStart)
-		attrState.Logs = append(attrState.Logs[idx:], currentTime)
+		attrState.Logs = appendLogs(attrState.Logs[idx:], currentTime, units)
 		attrState.LastUpdated = l.unitWrapper(time.Now())
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return receiptFor(ruleMap, currentTime, func(attrRule *structs.AttributeRule) (int64, int64, int64) {
+		// the logs have dropped out of every window once they are older than the longest one
+		return units, 0, currentTime + longestWindow(attrRule) + 1
+	}), nil
 }
@@ -25,7 +25,7 @@ func (l *StaticWindow) Allowed(ruleMap map[string]structs.EntityRules, stateMap
 			windowSize := subRule.Duration
 			windowStart := windowSize * (currentTime / windowSize)
 			idx := findWindowStartIndex(attrState.Logs, windowStart)
-			if !(idx <= logCount && logCount-idx <= subRule.Limit) {
+			if !(idx <= logCount && logCount-idx < subRule.Limit) {
 				return false
 			}
 		}
@@ -38,20 +38,51 @@ func (l *StaticWindow) Allowed(ruleMap map[string]structs.EntityRules, stateMap
 }
 
 func (l *StaticWindow) UpdateState(ruleMap map[string]structs.EntityRules, stateMap store.StateMap) error {
+	_, err := l.Consume(ruleMap, stateMap, 1)
+	return err
+}
+
+func (l *StaticWindow) Grantable(ruleMap map[string]structs.EntityRules, stateMap store.StateMap, n int64) (int64, int64, error) {
+	currentTime := l.unitWrapper(time.Now())
+	return grantable(ruleMap, stateMap, n, func(attrRule *structs.AttributeRule, attrState *store.AttributeState, n int64) (int64, int64) {
+		return grantableFromLogs(attrRule, attrState, n, func(rate *structs.Rate) int64 {
+			return rate.Duration * (currentTime / rate.Duration)
+		}, func(rate *structs.Rate, _ []int64, _ int64) int64 {
+			// the next unit is allowed when the next window starts
+			return rate.Duration*(currentTime/rate.Duration) + rate.Duration - currentTime
+		})
+	})
+}
+
+func (l *StaticWindow) Inspect(ruleMap map[string]structs.EntityRules, stateMap store.StateMap) ([]Usage, error) {
+	currentTime := l.unitWrapper(time.Now())
+	return inspect(ruleMap, stateMap, func(attrRule *structs.AttributeRule, attrState *store.AttributeState) []Usage {
+		return usageOfLogs(attrRule, attrState, currentTime, func(rate *structs.Rate) int64 {
+			return rate.Duration * (currentTime / rate.Duration)
+		}, func(rate *structs.Rate, _ []int64) int64 {
+			return rate.Duration*(currentTime/rate.Duration) + rate.Duration
+		})
+	})
+}
+
+func (l *StaticWindow) Consume(ruleMap map[string]structs.EntityRules, stateMap store.StateMap, units int64) (*structs.Receipt, error) {
 	// TODO: find a way to ensure the same timestamp is used for both check & update calls
 	currentTime := l.unitWrapper(time.Now())
-	return changeState(ruleMap, stateMap, func(attrRule *structs.AttributeRule, attrState *store.AttributeState) error {
+	err := changeState(ruleMap, stateMap, func(attrRule *structs.AttributeRule, attrState *store.AttributeState) error {
 		// purge logs older than maximum of all subRule durations
-		var windowSize int64
-		for _, rate := range attrRule.Rates {
-			if rate.Duration > windowSize {
-				windowSize = rate.Duration
-			}
-		}
+		windowSize := longestWindow(attrRule)
 		windowStart := windowSize * (currentTime / windowSize)
 		idx := findWindowStartIndex(attrState.Logs, windowStart)
-		attrState.Logs = append(attrState.Logs[idx:], currentTime)
+		attrState.Logs = appendLogs(attrState.Logs[idx:], currentTime, units)
 		attrState.LastUpdated = currentTime
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return receiptFor(ruleMap, currentTime, func(attrRule *structs.AttributeRule) (int64, int64, int64) {
+		// the logs no longer count once the current window of the longest rate is over
+		windowSize := longestWindow(attrRule)
+		return units, 0, windowSize*(currentTime/windowSize) + windowSize
+	}), nil
 }
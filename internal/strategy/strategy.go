@@ -11,10 +11,37 @@ import (
 type Limiter interface {
 	Allowed(ruleMap map[string]structs.EntityRules, stateMap store.StateMap) (bool, error)
 	UpdateState(ruleMap map[string]structs.EntityRules, stateMap store.StateMap) error
+
+	// Grantable returns how many units up to n the rules allow on top of the state and, when that is less than n,
+	// how long it takes in the time unit of the namespace until one more unit is allowed, -1 if it never is
+	Grantable(ruleMap map[string]structs.EntityRules, stateMap store.StateMap, n int64) (granted int64, wait int64, err error)
+	// Consume changes the state the way UpdateState does for each of the units, all at once, and returns
+	// a receipt without an ID for what was consumed
+	Consume(ruleMap map[string]structs.EntityRules, stateMap store.StateMap, units int64) (*structs.Receipt, error)
+
+	// Inspect reports the usage of every rate and bucket of the rules without changing the state
+	Inspect(ruleMap map[string]structs.EntityRules, stateMap store.StateMap) ([]Usage, error)
+}
+
+// Usage is how much of a single rate, or the bucket, of a rule has been used
+type Usage struct {
+	EntityType string
+	EntityName string
+	Rule       structs.AttributeRule
+	// Rate is the index of the rule's rate, -1 for its bucket
+	Rate  int
+	Limit int64
+	Used  int64
+	// ResetAt is when nothing is used any more if no more requests are made, in the time unit of the
+	// namespace. It is the current time when nothing is used and -1 when nothing is ever given back.
+	ResetAt int64
 }
 
 func FromConfig(config *structs.StrategyConfig) (Limiter, error) {
-	timeDispatch := timeDispatcherMap[config.TimeUnit]
+	timeDispatch, exists := timeDispatcherMap[config.TimeUnit]
+	if !exists {
+		return nil, fmt.Errorf("unsupported time unit %s", config.TimeUnit)
+	}
 	switch enums.GetStrategy(config.Type) {
 	case enums.StrategyRolling:
 		return getSlidingWindow(timeDispatch), nil
@@ -26,3 +53,9 @@ func FromConfig(config *structs.StrategyConfig) (Limiter, error) {
 		return nil, fmt.Errorf("no strategy found for type %s", config.Type)
 	}
 }
+
+// SupportsTimeUnit checks if the strategies can keep time in the unit specified
+func SupportsTimeUnit(unit string) bool {
+	_, exists := timeDispatcherMap[unit]
+	return exists
+}
@@ -0,0 +1,82 @@
+package strategy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/helpers"
+	"github.com/pronei/nogo/internal/store"
+	structs "github.com/pronei/nogo/shared"
+)
+
+func testLimiter(t *testing.T, strategyType string) Limiter {
+	t.Helper()
+	limiter, err := FromConfig(&structs.StrategyConfig{Type: strategyType, TimeUnit: constants.Second})
+	if err != nil {
+		t.Fatalf("could not create limiter - %v", err)
+	}
+	return limiter
+}
+
+// testRules returns a rule map with the single attribute rule passed for the user entity u1
+func testRules(rule structs.AttributeRule) map[string]structs.EntityRules {
+	return map[string]structs.EntityRules{
+		helpers.FormKey("user", "u1"): {EntityType: "user", EntityName: "u1", EntityAttributes: []structs.AttributeRule{rule}},
+	}
+}
+
+// testState returns a state map holding attrState for the rule passed
+func testState(rule structs.AttributeRule, attrState store.AttributeState) store.StateMap {
+	return store.StateMap{
+		helpers.FormKey("user", "u1"): {
+			EntityType:        "user",
+			EntityName:        "u1",
+			AttributeStateMap: map[string]store.AttributeState{rule.Key(): attrState},
+		},
+	}
+}
+
+func TestStaticWindowDeniesAtLimit(t *testing.T) {
+	limiter := testLimiter(t, "static_window")
+	rule := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Rates: []structs.Rate{{Duration: 3600, Limit: 2}}}
+	now := time.Now().Unix()
+
+	for logs, want := range map[int]bool{0: true, 1: true, 2: false, 3: false} {
+		attrState := store.AttributeState{LastUpdated: now}
+		for range logs {
+			attrState.Logs = append(attrState.Logs, now)
+		}
+		allowed, err := limiter.Allowed(testRules(rule), testState(rule, attrState))
+		if err != nil {
+			t.Fatalf("unexpected error - %v", err)
+		}
+		if allowed != want {
+			t.Errorf("with %d logs in the window and a limit of 2, allowed = %v, want %v", logs, allowed, want)
+		}
+	}
+}
+
+func TestFixedBucketKeepsRefilledTokens(t *testing.T) {
+	limiter := testLimiter(t, "fixed_bucket")
+	rule := structs.AttributeRule{AttributeType: "path", AttributeValue: "/a", Bucket: structs.Bucket{Duration: 3600, Refill: 2, Cost: 1, Maximum: 2}}
+	rules := testRules(rule)
+	// an empty bucket that was last touched a full refill ago holds two tokens by now
+	state := testState(rule, store.AttributeState{Bucket: 0, LastUpdated: time.Now().Unix() - 3600})
+
+	for i, want := range []bool{true, true, false} {
+		allowed, err := limiter.Allowed(rules, state)
+		if err != nil {
+			t.Fatalf("unexpected error - %v", err)
+		}
+		if allowed != want {
+			t.Fatalf("request %d: allowed = %v, want %v", i+1, allowed, want)
+		}
+		if !allowed {
+			break
+		}
+		if err = limiter.UpdateState(rules, state); err != nil {
+			t.Fatalf("unexpected error - %v", err)
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/pronei/nogo/internal/constants"
-	"github.com/pronei/nogo/internal/helpers"
 	"github.com/pronei/nogo/internal/store"
 	structs "github.com/pronei/nogo/shared"
 )
@@ -42,7 +41,7 @@ func evaluate(ruleMap map[string]structs.EntityRules, stateMap store.StateMap,
 			}
 
 			for _, attrRule := range rule.EntityAttributes {
-				key := helpers.FormKey(attrRule.AttributeType, attrRule.AttributeValue)
+				key := attrRule.Key()
 				if attrState, exists := state.AttributeStateMap[key]; exists {
 					if !stateChecker(&attrRule, &attrState) {
 						return false, nil
@@ -71,7 +70,7 @@ func changeState(ruleMap map[string]structs.EntityRules, stateMap store.StateMap
 		}
 
 		for _, attrRule := range entityRule.EntityAttributes {
-			attrKey := helpers.FormKey(attrRule.AttributeType, attrRule.AttributeValue)
+			attrKey := attrRule.Key()
 			attrState := entityState.AttributeStateMap[attrKey]
 			if err := stateUpdater(&attrRule, &attrState); err != nil {
 				return err
@@ -84,3 +83,135 @@ func changeState(ruleMap map[string]structs.EntityRules, stateMap store.StateMap
 
 	return nil
 }
+
+// appendLogs logs the units at currentTime
+func appendLogs(logs []int64, currentTime int64, units int64) []int64 {
+	for ; units > 0; units-- {
+		logs = append(logs, currentTime)
+	}
+	return logs
+}
+
+// grantable finds how many units up to n all the rules in the rule map allow on top of the state, and how long it
+// takes until they allow one more. stateGranter does the same for a single rule, with a wait of zero when the rule
+// allows more units than it was asked for and -1 when it never allows any more.
+func grantable(ruleMap map[string]structs.EntityRules, stateMap store.StateMap, n int64,
+	stateGranter func(*structs.AttributeRule, *store.AttributeState, int64) (int64, int64)) (int64, int64, error) {
+
+	granted := n
+	err := forEachState(ruleMap, stateMap, func(attrRule *structs.AttributeRule, attrState *store.AttributeState) {
+		ruleGranted, _ := stateGranter(attrRule, attrState, granted)
+		granted = min(granted, ruleGranted)
+	})
+	if err != nil || granted == n {
+		return granted, 0, err
+	}
+
+	// the rules are asked again for the wait once the units all of them allow are granted
+	var wait int64
+	err = forEachState(ruleMap, stateMap, func(attrRule *structs.AttributeRule, attrState *store.AttributeState) {
+		_, ruleWait := stateGranter(attrRule, attrState, granted)
+		wait = longerWait(wait, ruleWait)
+	})
+	return granted, wait, err
+}
+
+// forEachState calls stateVisitor on the state of every rule in the rule map, rules without state get the default struct value
+func forEachState(ruleMap map[string]structs.EntityRules, stateMap store.StateMap,
+	stateVisitor func(*structs.AttributeRule, *store.AttributeState)) error {
+
+	for entityKey, rule := range ruleMap {
+		state, exists := stateMap[entityKey]
+		if exists && (state.EntityType != rule.EntityType || state.EntityName != rule.EntityName) {
+			return fmt.Errorf("incorrect entity comparison E1 (rule) - %s:%s, E2 (state) - %s:%s\n",
+				rule.EntityType, rule.EntityName, state.EntityType, state.EntityName)
+		}
+
+		for _, attrRule := range rule.EntityAttributes {
+			attrState := state.AttributeStateMap[attrRule.Key()]
+			stateVisitor(&attrRule, &attrState)
+		}
+	}
+	return nil
+}
+
+// grantableFromLogs finds how many units up to n the rates of a window strategy allow on top of the logs, the
+// rates start their windows at windowStart. Rates that are full once the units are granted allow one more after freed.
+func grantableFromLogs(attrRule *structs.AttributeRule, attrState *store.AttributeState, n int64,
+	windowStart func(*structs.Rate) int64, freed func(rate *structs.Rate, windowLogs []int64, granted int64) int64) (int64, int64) {
+
+	granted := n
+	for _, rate := range attrRule.Rates {
+		count := int64(len(attrState.Logs) - findWindowStartIndex(attrState.Logs, windowStart(&rate)))
+		granted = min(granted, max(int64(rate.Limit)-count, 0))
+	}
+
+	var wait int64
+	for _, rate := range attrRule.Rates {
+		windowLogs := attrState.Logs[findWindowStartIndex(attrState.Logs, windowStart(&rate)):]
+		if int64(len(windowLogs))+granted < int64(rate.Limit) {
+			continue
+		}
+		if rate.Limit <= 0 {
+			return granted, -1
+		}
+		wait = longerWait(wait, freed(&rate, windowLogs, granted))
+	}
+	return granted, wait
+}
+
+// longerWait is the longer of both waits, where -1 waits forever
+func longerWait(a, b int64) int64 {
+	if a < 0 || b < 0 {
+		return -1
+	}
+	return max(a, b)
+}
+
+// longestWindow is the longest duration of the rule's rates, which logs are kept for
+func longestWindow(attrRule *structs.AttributeRule) int64 {
+	var windowSize int64
+	for _, rate := range attrRule.Rates {
+		windowSize = max(windowSize, rate.Duration)
+	}
+	return windowSize
+}
+
+// inspect lists the usage stateInspector finds for every rule in the rule map, rules without state get the default struct value
+func inspect(ruleMap map[string]structs.EntityRules, stateMap store.StateMap,
+	stateInspector func(*structs.AttributeRule, *store.AttributeState) []Usage) ([]Usage, error) {
+
+	var usage []Usage
+	for entityKey, rule := range ruleMap {
+		state, exists := stateMap[entityKey]
+		if exists && (state.EntityType != rule.EntityType || state.EntityName != rule.EntityName) {
+			return nil, fmt.Errorf("incorrect entity comparison E1 (rule) - %s:%s, E2 (state) - %s:%s\n",
+				rule.EntityType, rule.EntityName, state.EntityType, state.EntityName)
+		}
+
+		for _, attrRule := range rule.EntityAttributes {
+			attrState := state.AttributeStateMap[attrRule.Key()]
+			for _, ruleUsage := range stateInspector(&attrRule, &attrState) {
+				ruleUsage.EntityType, ruleUsage.EntityName, ruleUsage.Rule = rule.EntityType, rule.EntityName, attrRule
+				usage = append(usage, ruleUsage)
+			}
+		}
+	}
+	return usage, nil
+}
+
+// usageOfLogs finds the usage of every rate of a window strategy, the rates start their windows at windowStart and
+// are reset once the logs of their window have dropped out at resetAt
+func usageOfLogs(attrRule *structs.AttributeRule, attrState *store.AttributeState, currentTime int64,
+	windowStart func(*structs.Rate) int64, resetAt func(rate *structs.Rate, windowLogs []int64) int64) []Usage {
+
+	usage := make([]Usage, len(attrRule.Rates))
+	for i, rate := range attrRule.Rates {
+		windowLogs := attrState.Logs[findWindowStartIndex(attrState.Logs, windowStart(&rate)):]
+		usage[i] = Usage{Rate: i, Limit: int64(rate.Limit), Used: int64(len(windowLogs)), ResetAt: currentTime}
+		if len(windowLogs) > 0 {
+			usage[i].ResetAt = resetAt(&rate, windowLogs)
+		}
+	}
+	return usage
+}
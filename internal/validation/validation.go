@@ -0,0 +1,323 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	"github.com/pronei/nogo/internal/helpers"
+	"github.com/pronei/nogo/internal/strategy"
+	structs "github.com/pronei/nogo/shared"
+)
+
+type validator struct {
+	strategy enums.Strategy
+	action   enums.RuleAction
+	errs     structs.ValidationErrors
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	v.errs = append(v.errs, structs.ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Rules checks an import against the strategy and time unit of the namespace before it is accepted.
+// Every problem found is returned instead of the first one, nil means the import can be saved.
+// Durations written as strings are checked as they would be once converted to the time unit of the namespace,
+// the import itself is not changed.
+func Rules(imported *structs.RuleImport, action enums.RuleAction, config *structs.StrategyConfig) error {
+	v := &validator{strategy: enums.GetStrategy(config.Type), action: action}
+
+	if v.strategy == enums.StrategyUnknown {
+		v.add("strategyConfig.type", "unknown strategy %q", config.Type)
+	}
+	if !strategy.SupportsTimeUnit(config.TimeUnit) {
+		v.add("strategyConfig.timeUnit", "unsupported time unit %q", config.TimeUnit)
+	}
+	if imported == nil {
+		v.add("", "rule import is missing")
+		return v.errs
+	}
+	if unit, err := helpers.GetTimeInDurationWithError(1, config.TimeUnit); err == nil {
+		normalised, err := imported.Normalised(unit)
+		if errs, ok := err.(structs.ValidationErrors); ok {
+			v.errs = append(v.errs, errs...)
+		}
+		imported = normalised
+	}
+
+	entityKeys := make([]string, 0, len(imported.EntityRuleMap))
+	for key := range imported.EntityRuleMap {
+		entityKeys = append(entityKeys, key)
+	}
+	sort.Strings(entityKeys)
+
+	// rules are unique per entity type and key across the import, not just within a map entry
+	seen := make(map[string]string)
+	for _, entityKey := range entityKeys {
+		entity := imported.EntityRuleMap[entityKey]
+		v.entity(fmt.Sprintf("ruleMap[%s]", entityKey), &entity, entity.EntityType, seen)
+	}
+	for i := range imported.Overrides {
+		override := &imported.Overrides[i]
+		path := fmt.Sprintf("overrides[%d]", i)
+		if override.EntityName == "" {
+			v.add(path+".name", "override needs the name of the entity it is for")
+		}
+		// overrides are unique per entity and may share their conditions with the rules of its type
+		v.entity(path, override, "override"+constants.KeyDelimiter+override.EntityType+constants.KeyDelimiter+override.EntityName, seen)
+	}
+
+	for i := range imported.Plans {
+		plan := &imported.Plans[i]
+		path := fmt.Sprintf("plans[%d]", i)
+		if plan.EntityName == "" {
+			v.add(path+".name", "plan name is missing")
+		}
+		// plans are unique per entity type and name, each entity type has plans of its own
+		v.entity(path, plan, "plan"+constants.KeyDelimiter+plan.EntityType+constants.KeyDelimiter+plan.EntityName, seen)
+	}
+	for i := range imported.Exemptions {
+		v.exemption(fmt.Sprintf("exemptions[%d]", i), &imported.Exemptions[i], seen)
+	}
+	for i := range imported.Blocks {
+		v.block(fmt.Sprintf("blocks[%d]", i), &imported.Blocks[i], seen)
+	}
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+// entity checks the rules of an entity, scope is what the rules have to be unique within
+func (v *validator) entity(path string, entity *structs.EntityRules, scope string, seen map[string]string) {
+	if entity.EntityType == "" {
+		v.add(path+".type", "entity type is missing")
+	}
+	v.entityLimit(path, entity)
+
+	for i := range entity.EntityAttributes {
+		attribute := &entity.EntityAttributes[i]
+		attributePath := fmt.Sprintf("%s.attributes[%d]", path, i)
+
+		if !v.conditions(attributePath, attribute) {
+			continue
+		}
+		ruleKey := scope + constants.KeyDelimiter + attribute.Key()
+		if previous, exists := seen[ruleKey]; exists {
+			v.add(attributePath, "duplicate rule for %s, already defined at %s", attribute.Key(), previous)
+		} else {
+			seen[ruleKey] = attributePath
+		}
+
+		// deletions only need to identify the rule
+		if v.action == enums.RuleDelete {
+			continue
+		}
+		v.activation(attributePath, attribute)
+		switch v.strategy {
+		case enums.StrategyRolling, enums.StrategyStatic:
+			v.rates(attributePath, attribute)
+		case enums.StrategyFixedBucket:
+			v.bucket(attributePath, attribute)
+		}
+	}
+}
+
+// conditions returns false when the rule cannot be identified at all
+func (v *validator) conditions(path string, attribute *structs.AttributeRule) bool {
+	conditions := attribute.MatchConditions()
+	if len(conditions) == 0 {
+		v.add(path, "rule has no attribute conditions")
+		return false
+	}
+	if attribute.AttributeType == "" && attribute.AttributeValue != "" {
+		v.add(path+".type", "attribute value %q has no type", attribute.AttributeValue)
+	}
+	types := make(map[string]bool, len(conditions))
+	for _, condition := range conditions {
+		switch {
+		case condition.AttributeType == "":
+			v.add(path+".conditions", "condition with value %q has no type", condition.AttributeValue)
+		case condition.AttributeType == constants.EntityLimitAttribute:
+			v.add(path, "attribute type %s is reserved for entity limits", constants.EntityLimitAttribute)
+		case types[condition.AttributeType]:
+			v.add(path+".conditions", "attribute %s is used more than once and can never match", condition.AttributeType)
+		}
+		types[condition.AttributeType] = true
+	}
+	return true
+}
+
+// exemption needs exactly one of an entity name or an attribute to match on
+func (v *validator) exemption(path string, exemption *structs.Exemption, seen map[string]string) {
+	if exemption.EntityType == "" {
+		v.add(path+".entityType", "entity type is missing")
+	}
+	byName := exemption.EntityName != ""
+	byAttribute := exemption.AttributeType != "" || exemption.AttributeValue != ""
+	switch {
+	case byName && byAttribute:
+		v.add(path, "exemption can either be on the entity name or on an attribute, not both")
+		return
+	case !byName && !byAttribute:
+		v.add(path, "exemption needs an entity name or an attribute")
+		return
+	case byAttribute && exemption.AttributeType == "":
+		v.add(path+".type", "attribute value %q has no type", exemption.AttributeValue)
+		return
+	}
+	key := fmt.Sprintf("exemption:%s:%s:%s:%s", exemption.EntityType, exemption.EntityName, exemption.AttributeType, exemption.AttributeValue)
+	if previous, exists := seen[key]; exists {
+		v.add(path, "duplicate exemption, already defined at %s", previous)
+	} else {
+		seen[key] = path
+	}
+}
+
+// block needs exactly one of an entity name, an attribute or a pattern to match on and a reason to give
+func (v *validator) block(path string, block *structs.Block, seen map[string]string) {
+	if block.EntityType == "" {
+		v.add(path+".entityType", "entity type is missing")
+	}
+	byName := block.EntityName != ""
+	byAttribute := block.AttributeValue != ""
+	byPattern := block.Pattern != ""
+	switch {
+	case byName && (byAttribute || byPattern) || byAttribute && byPattern:
+		v.add(path, "block can only be on one of the entity name, an attribute or a pattern")
+		return
+	case !byName && !byAttribute && !byPattern:
+		v.add(path, "block needs an entity name, an attribute or a pattern")
+		return
+	case byAttribute && block.AttributeType == "":
+		v.add(path+".type", "attribute value %q has no type", block.AttributeValue)
+		return
+	case byName && block.AttributeType != "":
+		v.add(path+".type", "attribute type %q has no value", block.AttributeType)
+		return
+	}
+	if byPattern {
+		if _, err := regexp.Compile(block.Pattern); err != nil {
+			v.add(path+".pattern", "invalid pattern - %s", err.Error())
+		}
+	}
+	key := fmt.Sprintf("block:%s:%s:%s:%s:%s", block.EntityType, block.EntityName, block.AttributeType, block.AttributeValue, block.Pattern)
+	if previous, exists := seen[key]; exists {
+		v.add(path, "duplicate block, already defined at %s", previous)
+	} else {
+		seen[key] = path
+	}
+	if v.action != enums.RuleDelete && block.Reason == "" {
+		v.add(path+".reason", "block needs a reason to give to the caller")
+	}
+}
+
+func (v *validator) activation(path string, attribute *structs.AttributeRule) {
+	if attribute.ActiveFrom != nil && attribute.ActiveUntil != nil && !attribute.ActiveFrom.Before(*attribute.ActiveUntil) {
+		v.add(path+".activeUntil", "rule is never active, %s is not after %s",
+			attribute.ActiveUntil.Format(time.RFC3339), attribute.ActiveFrom.Format(time.RFC3339))
+	}
+	if attribute.Schedule != nil {
+		schedule := *attribute.Schedule
+		if err := schedule.Compile(); err != nil {
+			v.add(path+".schedule", "%s", err.Error())
+		}
+	}
+}
+
+func (v *validator) rates(path string, attribute *structs.AttributeRule) {
+	if len(attribute.Rates) == 0 {
+		v.add(path+".rates", "%s namespaces need at least one rate", strategyName(v.strategy))
+	}
+	if attribute.Bucket != (structs.Bucket{}) {
+		v.add(path+".bucket", "bucket is ignored by %s namespaces", strategyName(v.strategy))
+	}
+	for i, rate := range attribute.Rates {
+		ratePath := fmt.Sprintf("%s.rates[%d]", path, i)
+		if rate.Duration <= 0 {
+			v.add(ratePath+".duration", "duration must be positive, got %d", rate.Duration)
+		}
+		if rate.Limit < 0 {
+			v.add(ratePath+".limit", "limit cannot be negative, got %d", rate.Limit)
+		}
+	}
+}
+
+func (v *validator) bucket(path string, attribute *structs.AttributeRule) {
+	if len(attribute.Rates) > 0 {
+		v.add(path+".rates", "rates are ignored by %s namespaces", strategyName(v.strategy))
+	}
+	bucket := attribute.Bucket
+	if bucket.Duration <= 0 {
+		v.add(path+".bucket.duration", "duration must be positive, got %d", bucket.Duration)
+	}
+	if bucket.Refill < 0 {
+		v.add(path+".bucket.refill", "refill cannot be negative, got %d", bucket.Refill)
+	}
+	if bucket.Cost <= 0 {
+		v.add(path+".bucket.cost", "cost must be positive, got %d", bucket.Cost)
+	}
+	if bucket.Maximum < bucket.Cost {
+		v.add(path+".bucket.maximum", "maximum of %d is less than the cost of %d and can never pass", bucket.Maximum, bucket.Cost)
+	}
+}
+
+// entityLimit ensures the entity limit is well-formed and that it does not make any of the
+// attribute rates in the same import unreachable, i.e. a higher limit over a window it already covers
+func (v *validator) entityLimit(path string, entity *structs.EntityRules) {
+	if entity.EntityLimit == 0 && entity.EntityDuration == 0 {
+		return
+	}
+	if entity.EntityLimit <= 0 {
+		v.add(path+".limit", "entity limit must be positive, got %d", entity.EntityLimit)
+	}
+	if entity.EntityDuration <= 0 {
+		v.add(path+".duration", "entity limit needs a positive duration, got %d", entity.EntityDuration)
+	}
+	if v.action == enums.RuleDelete || entity.EntityLimit <= 0 {
+		return
+	}
+	limit := int64(entity.EntityLimit)
+	for i, attribute := range entity.EntityAttributes {
+		for j, rate := range attribute.Rates {
+			if rate.Duration <= entity.EntityDuration && rate.Limit > entity.EntityLimit {
+				v.add(fmt.Sprintf("%s.attributes[%d].rates[%d]", path, i, j),
+					"rate of %d per %d can never be reached with an entity limit of %d per %d",
+					rate.Limit, rate.Duration, entity.EntityLimit, entity.EntityDuration)
+			}
+		}
+		// the entity limit takes a single token per request, so a bucket is compared in requests
+		bucket := attribute.Bucket
+		if v.strategy != enums.StrategyFixedBucket || bucket.Cost <= 0 {
+			continue
+		}
+		bucketPath := fmt.Sprintf("%s.attributes[%d].bucket", path, i)
+		if bucket.Maximum/bucket.Cost > limit {
+			v.add(bucketPath+".maximum",
+				"maximum of %d holds %d requests at a cost of %d, more than the entity limit of %d per %d lets through",
+				bucket.Maximum, bucket.Maximum/bucket.Cost, bucket.Cost, entity.EntityLimit, entity.EntityDuration)
+		}
+		if bucket.Duration <= entity.EntityDuration && bucket.Refill/bucket.Cost > limit {
+			v.add(bucketPath+".refill",
+				"refill of %d per %d at a cost of %d can never be used with an entity limit of %d per %d",
+				bucket.Refill, bucket.Duration, bucket.Cost, entity.EntityLimit, entity.EntityDuration)
+		}
+	}
+}
+
+func strategyName(s enums.Strategy) string {
+	switch s {
+	case enums.StrategyStatic:
+		return "static_window"
+	case enums.StrategyRolling:
+		return "rolling_window"
+	case enums.StrategyFixedBucket:
+		return "fixed_bucket"
+	default:
+		return "unknown"
+	}
+}
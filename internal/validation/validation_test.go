@@ -0,0 +1,89 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	structs "github.com/pronei/nogo/shared"
+)
+
+func TestRulesLeavesDurationsAsWritten(t *testing.T) {
+	imported := &structs.RuleImport{}
+	rules := `{"ruleMap": {"user": {"type": "user", "attributes": [{"type": "tier", "value": "free", "rates": [{"duration": "1m", "limit": 10}]}]}}}`
+	if err := json.Unmarshal([]byte(rules), imported); err != nil {
+		t.Fatalf("could not parse rules - %v", err)
+	}
+
+	config := &structs.StrategyConfig{Type: "rolling_window", TimeUnit: constants.Second}
+	if err := Rules(imported, enums.RuleAdd, config); err != nil {
+		t.Fatalf("rules are valid, got %v", err)
+	}
+	if got := imported.EntityRuleMap["user"].EntityAttributes[0].Rates[0].Duration; got != int64(time.Minute) {
+		t.Errorf("validation changed the duration to %d", got)
+	}
+
+	normalised, err := imported.Normalised(time.Second)
+	if err != nil {
+		t.Fatalf("could not normalise - %v", err)
+	}
+	if got := normalised.EntityRuleMap["user"].EntityAttributes[0].Rates[0].Duration; got != 60 {
+		t.Errorf("normalised duration = %d, want 60", got)
+	}
+	if got := imported.EntityRuleMap["user"].EntityAttributes[0].Rates[0].Duration; got != int64(time.Minute) {
+		t.Errorf("normalising changed the import to %d", got)
+	}
+}
+
+func TestRulesRejectsPartialUnits(t *testing.T) {
+	imported := &structs.RuleImport{}
+	rules := `{"ruleMap": {"user": {"type": "user", "attributes": [{"type": "tier", "value": "free", "rates": [{"duration": "1500ms", "limit": 10}]}]}}}`
+	if err := json.Unmarshal([]byte(rules), imported); err != nil {
+		t.Fatalf("could not parse rules - %v", err)
+	}
+	err := Rules(imported, enums.RuleAdd, &structs.StrategyConfig{Type: "rolling_window", TimeUnit: constants.Second})
+	errs, ok := err.(structs.ValidationErrors)
+	if !ok || len(errs) != 1 || errs[0].Path != "ruleMap[user].attributes[0].rates[0].duration" {
+		t.Errorf("want a single error on the rate duration, got %v", err)
+	}
+}
+
+func TestRulesRejectsBucketsBeyondTheEntityLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket string
+		paths  []string
+	}{
+		{"within the limit", `{"duration": "1s", "refill": 10, "cost": 2, "maximum": 20}`, nil},
+		{"maximum beyond the limit", `{"duration": "1s", "refill": 5, "cost": 1, "maximum": 11}`, []string{"ruleMap[user].attributes[0].bucket.maximum"}},
+		{"refill beyond the limit", `{"duration": "1s", "refill": 12, "cost": 1, "maximum": 10}`, []string{"ruleMap[user].attributes[0].bucket.refill"}},
+		{"slower refill over a longer duration", `{"duration": "1m", "refill": 100, "cost": 1, "maximum": 10}`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			imported := &structs.RuleImport{}
+			rules := `{"ruleMap": {"user": {"type": "user", "limit": 10, "duration": "10s", "attributes": [{"type": "tier", "value": "free", "bucket": ` + test.bucket + `}]}}}`
+			if err := json.Unmarshal([]byte(rules), imported); err != nil {
+				t.Fatalf("could not parse rules - %v", err)
+			}
+			err := Rules(imported, enums.RuleAdd, &structs.StrategyConfig{Type: "fixed_bucket", TimeUnit: constants.Second})
+			if test.paths == nil {
+				if err != nil {
+					t.Fatalf("rules are valid, got %v", err)
+				}
+				return
+			}
+			errs, ok := err.(structs.ValidationErrors)
+			if !ok || len(errs) != len(test.paths) {
+				t.Fatalf("want errors on %v, got %v", test.paths, err)
+			}
+			for i, path := range test.paths {
+				if errs[i].Path != path {
+					t.Errorf("error %d is on %s, want %s", i, errs[i].Path, path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+)
+
+// Extractor reads a value out of an HTTP request and reports false when the request has none
+type Extractor func(r *http.Request) (string, bool)
+
+// Header extracts the value of a request header
+func Header(name string) Extractor {
+	return func(r *http.Request) (string, bool) {
+		value := r.Header.Get(name)
+		return value, value != ""
+	}
+}
+
+// PathValue extracts a wildcard of the pattern the request was routed by, see http.Request.PathValue
+func PathValue(name string) Extractor {
+	return func(r *http.Request) (string, bool) {
+		value := r.PathValue(name)
+		return value, value != ""
+	}
+}
+
+// Query extracts a query parameter of the request URL
+func Query(name string) Extractor {
+	return func(r *http.Request) (string, bool) {
+		value := r.URL.Query().Get(name)
+		return value, value != ""
+	}
+}
+
+// RemoteIP extracts the IP address the request came from, without the port. Behind a proxy the address
+// is the proxy's, the client's is usually found with Header("X-Forwarded-For") instead.
+func RemoteIP() Extractor {
+	return func(r *http.Request) (string, bool) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return host, host != ""
+	}
+}
+
+// Static always extracts the same value, e.g. to limit every request under one entity name
+func Static(value string) Extractor {
+	return func(*http.Request) (string, bool) {
+		return value, true
+	}
+}
@@ -0,0 +1,170 @@
+// Package middleware limits the requests served by a net/http handler with a rate limiter. Each request is turned
+// into a LimitRequest through extractors, denied requests are answered with a 429 and every response carries the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, along with Retry-After once denied.
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pronei/nogo/client"
+	"github.com/pronei/nogo/internal/helpers"
+	structs "github.com/pronei/nogo/shared"
+)
+
+// Entity describes how an entity of the LimitRequest is built out of an HTTP request
+type Entity struct {
+	Type string
+	// Name of the entity, it is left out of the LimitRequest when the request has none
+	Name Extractor
+	// Attributes of the entity by attribute type, those the request has no value for are left out
+	Attributes map[string]Extractor
+}
+
+type Options struct {
+	Entities []Entity
+	// FailOpen serves the requests that cannot be evaluated instead of answering them through OnError
+	FailOpen bool
+	// OnDeny answers a denied request, the rate limit headers are set already. Defaults to a 429 with the
+	// reason of the decision as the body.
+	OnDeny func(w http.ResponseWriter, r *http.Request, decision *structs.Decision)
+	// OnError answers a request that cannot be evaluated when failing closed, defaults to a 503
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+type middleware struct {
+	limiter client.Inspector
+	opts    Options
+	logger  helpers.Logger
+}
+
+// New returns middleware evaluating and updating the limits of every request before it is handled.
+// Requests that none of the entities can be built for are served without being limited.
+func New(logger helpers.Logger, limiter client.Inspector, opts Options) func(http.Handler) http.Handler {
+	if opts.OnDeny == nil {
+		opts.OnDeny = deny
+	}
+	if opts.OnError == nil {
+		opts.OnError = unavailable
+	}
+	entities := opts.Entities[:0:0]
+	for _, entity := range opts.Entities {
+		if entity.Name == nil {
+			logger.Warn("skipping entity of type %s without a name extractor\n", entity.Type)
+			continue
+		}
+		entities = append(entities, entity)
+	}
+	opts.Entities = entities
+	m := &middleware{limiter: limiter, opts: opts, logger: logger}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request := m.limitRequest(r)
+			if len(request.Parameters) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			inspection, err := m.limiter.EvaluateAndInspect(r.Context(), request)
+			if err != nil {
+				m.logger.Warn("cannot evaluate %s %s - %s\n", r.Method, r.URL.Path, err.Error())
+				if m.opts.FailOpen {
+					next.ServeHTTP(w, r)
+				} else {
+					m.opts.OnError(w, r, err)
+				}
+				return
+			}
+
+			setHeaders(w.Header(), inspection, time.Now())
+			if !inspection.Allowed {
+				m.opts.OnDeny(w, r, &inspection.Decision)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (m *middleware) limitRequest(r *http.Request) *structs.LimitRequest {
+	request := &structs.LimitRequest{Parameters: make(map[string]structs.EntityParameters)}
+	for _, entity := range m.opts.Entities {
+		name, ok := entity.Name(r)
+		if !ok {
+			continue
+		}
+		attributes := make(map[string]string)
+		for attrType, extract := range entity.Attributes {
+			if value, ok := extract(r); ok {
+				attributes[attrType] = value
+			}
+		}
+		request.Parameters[name] = structs.EntityParameters{EntityType: entity.Type, AttributesMap: attributes}
+	}
+	return request
+}
+
+// setHeaders sets the RateLimit headers for the enforced limit with the fewest requests remaining, and Retry-After
+// for denied requests. Shadow limits are left out as they never deny.
+func setHeaders(header http.Header, inspection *structs.Inspection, now time.Time) {
+	var closest *structs.Usage
+	var limit, remaining int64
+	for i := range inspection.Usage {
+		usage := &inspection.Usage[i]
+		if usage.Shadow {
+			continue
+		}
+		usageLimit, usageRemaining := requests(usage)
+		if closest == nil || usageRemaining < remaining {
+			closest, limit, remaining = usage, usageLimit, usageRemaining
+		}
+	}
+	if closest != nil {
+		header.Set("RateLimit-Limit", strconv.FormatInt(limit, 10))
+		header.Set("RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		if !closest.ResetAt.IsZero() {
+			header.Set("RateLimit-Reset", seconds(closest.ResetAt.Sub(now)))
+		}
+	}
+	if inspection.Allowed {
+		return
+	}
+
+	// a denied request can be retried once its block has expired or its limits allow one more request
+	switch block := inspection.Block; {
+	case block != nil && block.ExpiresAt != nil:
+		header.Set("Retry-After", seconds(block.ExpiresAt.Sub(now)))
+	case block == nil && inspection.RetryAfter > 0:
+		header.Set("Retry-After", seconds(inspection.RetryAfter))
+	}
+}
+
+// requests converts the usage to requests, rates count requests already while buckets count tokens
+// of which every request takes the cost of the bucket
+func requests(usage *structs.Usage) (limit, remaining int64) {
+	cost := usage.Rule.Bucket.Cost
+	if usage.Rate != nil || cost <= 1 {
+		return usage.Limit, usage.Remaining
+	}
+	return usage.Limit / cost, usage.Remaining / cost
+}
+
+// seconds is the duration in whole seconds, rounded up so that clients do not come back too early
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(max(d, 0).Seconds())), 10)
+}
+
+func deny(w http.ResponseWriter, _ *http.Request, decision *structs.Decision) {
+	reason := decision.Reason
+	if reason == "" {
+		reason = http.StatusText(http.StatusTooManyRequests)
+	}
+	http.Error(w, reason, http.StatusTooManyRequests)
+}
+
+func unavailable(w http.ResponseWriter, _ *http.Request, _ error) {
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pronei/nogo/client"
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	structs "github.com/pronei/nogo/shared"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(...any)  {}
+func (nopLogger) Debug(...any) {}
+func (nopLogger) Error(...any) {}
+func (nopLogger) Warn(...any)  {}
+func (nopLogger) Fatal(...any) {}
+func (nopLogger) Panic(...any) {}
+
+// stubLimiter answers every evaluation with the same inspection or error
+type stubLimiter struct {
+	client.Inspector
+	inspection *structs.Inspection
+	err        error
+}
+
+func (s *stubLimiter) EvaluateAndInspect(context.Context, *structs.LimitRequest) (*structs.Inspection, error) {
+	return s.inspection, s.err
+}
+
+func TestMiddleware(t *testing.T) {
+	rate := structs.Rate{Duration: 60, Limit: 10}
+	usage := structs.Usage{Rate: &rate, Limit: 10, Used: 10, Remaining: 0, ResetAt: time.Now().Add(time.Minute)}
+	allowed := &structs.Inspection{Decision: structs.Decision{Allowed: true}, Usage: []structs.Usage{{Rate: &rate, Limit: 10, Used: 4, Remaining: 6}}}
+	denied := &structs.Inspection{Decision: structs.Decision{Allowed: false}, Usage: []structs.Usage{usage}, RetryAfter: 5 * time.Second}
+	teapot := func(w http.ResponseWriter, _ *http.Request, _ *structs.Decision) { w.WriteHeader(http.StatusTeapot) }
+	internal := func(w http.ResponseWriter, _ *http.Request, _ error) { w.WriteHeader(http.StatusInternalServerError) }
+
+	tests := []struct {
+		name       string
+		limiter    *stubLimiter
+		opts       Options
+		noUser     bool
+		wantStatus int
+		wantHeader map[string]string
+	}{
+		{name: "allowed", limiter: &stubLimiter{inspection: allowed}, wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"RateLimit-Limit": "10", "RateLimit-Remaining": "6", "Retry-After": ""}},
+		{name: "denied", limiter: &stubLimiter{inspection: denied}, wantStatus: http.StatusTooManyRequests,
+			wantHeader: map[string]string{"RateLimit-Limit": "10", "RateLimit-Remaining": "0", "RateLimit-Reset": "60", "Retry-After": "5"}},
+		{name: "custom deny", limiter: &stubLimiter{inspection: denied}, opts: Options{OnDeny: teapot}, wantStatus: http.StatusTeapot,
+			wantHeader: map[string]string{"Retry-After": "5"}},
+		{name: "fail open", limiter: &stubLimiter{err: errors.New("store is down")}, opts: Options{FailOpen: true}, wantStatus: http.StatusOK},
+		{name: "fail closed", limiter: &stubLimiter{err: errors.New("store is down")}, wantStatus: http.StatusServiceUnavailable},
+		{name: "custom error", limiter: &stubLimiter{err: errors.New("store is down")}, opts: Options{OnError: internal}, wantStatus: http.StatusInternalServerError},
+		{name: "no entity", limiter: &stubLimiter{err: errors.New("not evaluated")}, noUser: true, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Entities = []Entity{{Type: "user", Name: Header("X-User"), Attributes: map[string]Extractor{"tier": Static("free")}}}
+			handler := New(nopLogger{}, tt.limiter, tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if !tt.noUser {
+				req.Header.Set("X-User", "u1")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			for key, want := range tt.wantHeader {
+				if got := rec.Header().Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	now := time.Now()
+	expiresAt := now.Add(90 * time.Second)
+	bucket := structs.AttributeRule{Bucket: structs.Bucket{Duration: 60, Refill: 100, Cost: 10, Maximum: 100}}
+	rate := structs.Rate{Duration: 60, Limit: 20}
+	tests := []struct {
+		name       string
+		inspection *structs.Inspection
+		wantHeader map[string]string
+	}{
+		{
+			name: "bucket tokens are counted in requests",
+			inspection: &structs.Inspection{Decision: structs.Decision{Allowed: true}, Usage: []structs.Usage{
+				{Rule: bucket, Limit: 100, Used: 30, Remaining: 75},
+				{Rate: &rate, Limit: 20, Used: 12, Remaining: 8},
+			}},
+			wantHeader: map[string]string{"RateLimit-Limit": "10", "RateLimit-Remaining": "7"},
+		},
+		{
+			name: "shadow limits are left out",
+			inspection: &structs.Inspection{Decision: structs.Decision{Allowed: true}, Usage: []structs.Usage{
+				{Rate: &rate, Limit: 20, Used: 12, Remaining: 8},
+				{Rate: &rate, Shadow: true, Limit: 5, Used: 5, Remaining: 0},
+			}},
+			wantHeader: map[string]string{"RateLimit-Limit": "20", "RateLimit-Remaining": "8"},
+		},
+		{
+			name: "retry after a block expires",
+			inspection: &structs.Inspection{Decision: structs.Decision{Block: &structs.Block{ExpiresAt: &expiresAt}},
+				RetryAfter: time.Second},
+			wantHeader: map[string]string{"Retry-After": "90"},
+		},
+		{
+			name:       "no retry when the limits never allow it again",
+			inspection: &structs.Inspection{Usage: []structs.Usage{{Rule: bucket, Limit: 100, Used: 100}}},
+			wantHeader: map[string]string{"RateLimit-Remaining": "0", "Retry-After": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			setHeaders(header, tt.inspection, now)
+			for key, want := range tt.wantHeader {
+				if got := header.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareWithLimiter(t *testing.T) {
+	config := &structs.RateLimiterConfig{
+		Namespace:      t.Name(),
+		StrategyConfig: structs.StrategyConfig{Type: "rolling_window", TimeUnit: constants.Second},
+		StorageType:    enums.InMemoryStorage,
+	}
+	rules := &structs.RuleImport{EntityRuleMap: map[string]structs.EntityRules{"user": {
+		EntityType:       "user",
+		EntityAttributes: []structs.AttributeRule{{AttributeType: "tier", AttributeValue: "free", Rates: []structs.Rate{{Duration: 60, Limit: 2}}}},
+	}}}
+	limiter, err := client.Create(nopLogger{}, config, rules)
+	if err != nil {
+		t.Fatalf("could not create rate limiter - %v", err)
+	}
+	defer limiter.(client.Closer).Close()
+
+	handler := New(nopLogger{}, limiter.(client.Inspector), Options{
+		Entities: []Entity{{Type: "user", Name: Header("X-User"), Attributes: map[string]Extractor{"tier": Static("free")}}},
+	})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User", "u1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("request %d: status = %d, want %d", i+1, rec.Code, want)
+		}
+		if remaining := rec.Header().Get("RateLimit-Remaining"); remaining != []string{"1", "0", "0"}[i] {
+			t.Errorf("request %d: remaining = %s", i+1, remaining)
+		}
+		if i == 2 {
+			if retryAfter := rec.Header().Get("Retry-After"); retryAfter == "" || retryAfter == "0" || len(retryAfter) > 2 {
+				t.Errorf("Retry-After = %q, want up to a minute", retryAfter)
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package structs
+
+import (
+	"time"
+
+	"github.com/pronei/nogo/internal/enums"
+)
+
+// StateChange is an administrative change to the state of an entity, it is recorded in the audit log
+type StateChange struct {
+	EntityType string `json:"entityType"`
+	EntityName string `json:"name"`
+	// Attributes are the keys of the rules to reset the state of (see AttributeRule.Key), all of them when empty
+	Attributes []string `json:"attributes,omitempty"`
+	// Credits to grant the entity
+	Credits int64 `json:"credits,omitempty"`
+
+	// Actor made the change for Reason
+	Actor  string `json:"actor"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// AuditEntry records a StateChange made through Action at a point in time
+type AuditEntry struct {
+	StateChange
+	Action enums.AdminAction `json:"action"`
+	At     time.Time         `json:"at"`
+}
@@ -1,20 +1,37 @@
 package structs
 
 import (
+	"context"
+
 	"github.com/pronei/nogo/internal/enums"
 	"github.com/redis/go-redis/v9"
 )
 
 // TODO: make it more generic to support different dbs
 type RateLimiterConfig struct {
-	Namespace           string         `json:"namespace"`
-	StrategyConfig      StrategyConfig `json:"strategyConfig"`
-	StorageType         enums.Storage  `json:"storageType"`
-	RedisConfig         RedisConfig    `json:"redisConfig"`
-	InMemoryConfig      InMemoryConfig `json:"inMemoryConfig"`
+	Namespace           string           `json:"namespace"`
+	StrategyConfig      StrategyConfig   `json:"strategyConfig"`
+	Evaluation          enums.Evaluation `json:"evaluation"`
+	StorageType         enums.Storage    `json:"storageType"`
+	RedisConfig         RedisConfig      `json:"redisConfig"`
+	SyncRules           bool             `json:"syncRules"`
+	InMemoryConfig      InMemoryConfig   `json:"inMemoryConfig"`
 	ExistingRedisClient *redis.Client
+
+	// RuleHistory is the number of previous rule versions kept for rollback, 10 when nil and none when 0
+	RuleHistory *int `json:"ruleHistory,omitempty"`
+
+	// ReservationTimeout is how long a reservation is held for before the estimate is returned, 5 minutes by default
+	ReservationTimeout Duration `json:"reservationTimeout"`
+
+	// Shadow treats every rule of the namespace as a shadow rule, ShadowHook is called with every decision
+	// where a shadow rule would have denied the request
+	Shadow     bool       `json:"shadow"`
+	ShadowHook ShadowHook `json:"-"`
 }
 
+type ShadowHook func(ctx context.Context, req *LimitRequest, decision *Decision)
+
 type StrategyConfig struct {
 	Type     string `json:"type"`
 	TimeUnit string `json:"timeUnit"`
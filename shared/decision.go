@@ -0,0 +1,116 @@
+package structs
+
+import "time"
+
+// Decision explains how a LimitRequest was evaluated
+type Decision struct {
+	Allowed bool `json:"allowed"`
+
+	// Bypass is the exemption that let the request through without looking at any limits
+	Bypass *Exemption `json:"bypass,omitempty"`
+	// Block is the block that denied the request without looking at any limits
+	Block  *Block `json:"block,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	// WouldDeny lists the shadow rules that would have denied the request had they been enforced
+	WouldDeny []ShadowDenial `json:"wouldDeny,omitempty"`
+
+	// Receipt identifies what an allowed request consumed when the state was updated, see Refund
+	Receipt *Receipt `json:"receipt,omitempty"`
+
+	// Credited lists the entities, as type:name, whose limits denied the request and that paid for it with a credit
+	Credited []string `json:"credited,omitempty"`
+}
+
+type ShadowDenial struct {
+	EntityType string        `json:"entityType"`
+	EntityName string        `json:"name"`
+	Rule       AttributeRule `json:"rule"`
+}
+
+// Allowance explains how many units of a LimitRequest were allowed when asking for up to N of them
+type Allowance struct {
+	// Decision is allowed when any units were granted, a bypass grants all of them
+	Decision
+
+	// Granted units were consumed, the Backlog are the ones asked for that were not
+	Granted int64 `json:"granted"`
+	Backlog int64 `json:"backlog"`
+	// RetryAfter is how long it takes until at least one more unit can be granted. It is zero when nothing
+	// is left in the backlog or when Never is set.
+	RetryAfter time.Duration `json:"retryAfter"`
+	// Never is set when the rules will never grant any of the backlog, such as a bucket that does not refill
+	// or a block that does not expire, retrying makes no difference until the rules change
+	Never bool `json:"never,omitempty"`
+}
+
+// Receipt identifies the log entries and tokens a request consumed so that exactly those can be refunded. The receipt
+// is kept by the rate limiter when it is issued, a refund goes by its ID and takes back what was kept, never what the
+// entries of the receipt it was given say.
+type Receipt struct {
+	ID string `json:"id"`
+	// At is when the units were consumed and logged, ExpiresAt when refunding them no longer makes
+	// a difference as they have dropped out of every window or the buckets are full again. Both are in the
+	// time unit of the namespace, a receipt without ExpiresAt never expires.
+	At        int64 `json:"at"`
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+
+	Entries []ReceiptEntry `json:"entries"`
+}
+
+// ReceiptEntry is what was consumed from the state of a single rule
+type ReceiptEntry struct {
+	EntityType string `json:"entityType"`
+	EntityName string `json:"name"`
+	// Key of the rule's state, see AttributeRule.Key
+	Key    string `json:"key"`
+	Logs   int64  `json:"logs,omitempty"`
+	Tokens int64  `json:"tokens,omitempty"`
+	// Maximum of the bucket the tokens were taken from, refunding them does not fill it beyond
+	Maximum int64 `json:"maximum,omitempty"`
+}
+
+// Reservation holds the estimated cost of a request until it is settled with the actual cost
+type Reservation struct {
+	// Decision is allowed when the estimate was reserved, its receipt is for the estimated units
+	Decision
+
+	ID       string `json:"id"`
+	Estimate int64  `json:"estimate"`
+	// ExpiresAt is when the estimate is returned if the reservation has not been settled by then
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Inspection shows how much of its limits a request has used without consuming anything
+type Inspection struct {
+	// Decision is allowed when the request would be allowed right now
+	Decision
+
+	Usage []Usage `json:"usage"`
+	// RetryAfter is how long it takes until the limits allow the request again when they deny it. It is zero
+	// when the request is allowed, is not denied by its limits or when Never is set.
+	RetryAfter time.Duration `json:"retryAfter,omitempty"`
+	// Never is set when the limits deny the request and will never allow it until the rules change
+	Never bool `json:"never,omitempty"`
+}
+
+// Usage is how much of a single rate, or the bucket, of a rule matching the request has been used.
+// Rates count requests and buckets count tokens.
+type Usage struct {
+	EntityType string        `json:"entityType"`
+	EntityName string        `json:"name"`
+	Rule       AttributeRule `json:"rule"`
+	// Rate is the rate of the rule the usage is for, nil for its bucket
+	Rate *Rate `json:"rate,omitempty"`
+	// Shadow is set for the usage of shadow rules, which only report when they would deny
+	Shadow bool `json:"shadow,omitempty"`
+
+	Limit     int64 `json:"limit"`
+	Used      int64 `json:"used"`
+	Remaining int64 `json:"remaining"`
+	// Utilisation is the share of the limit that has been used, from 0 and above 1 once charges went past it
+	Utilisation float64 `json:"utilisation"`
+	// ResetAt is when nothing is used any more if no more requests are made, it is zero when nothing
+	// is ever given back
+	ResetAt time.Time `json:"resetAt"`
+}
@@ -0,0 +1,30 @@
+package structs
+
+// RuleDiff lists what changes between the rules in use and a rule set, section by section
+type RuleDiff struct {
+	// Version of the rules that were compared against
+	Version  uint64       `json:"version"`
+	Added    []RuleChange `json:"added,omitempty"`
+	Removed  []RuleChange `json:"removed,omitempty"`
+	Modified []RuleChange `json:"modified,omitempty"`
+}
+
+// RuleChange is a single rule, exemption or block that changes, Section is where it is found in an import
+// (ruleMap, overrides, plans, exemptions or blocks) and Key identifies it within the section
+type RuleChange struct {
+	Section string        `json:"section"`
+	Key     string        `json:"key"`
+	Fields  []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange is a field of a modified rule, Path is in the rule's JSON form, e.g. rates[0].limit
+type FieldChange struct {
+	Path string `json:"path"`
+	From any    `json:"from,omitempty"`
+	To   any    `json:"to,omitempty"`
+}
+
+// Empty is true when the rule set is the same as the one in use
+func (d *RuleDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
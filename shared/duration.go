@@ -2,6 +2,7 @@ package structs
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -27,3 +28,130 @@ func (d Duration) MarshalJSON() ([]byte, error) {
 func (d Duration) ToStd() time.Duration {
 	return time.Duration(d)
 }
+
+// parseRuleDuration reads a duration of a rule, which is either an integer in the time unit of the namespace
+// or a Go duration string, in which case it is returned in nanoseconds
+func parseRuleDuration(raw json.RawMessage) (value int64, nanos bool, err error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, false, nil
+	}
+	if raw[0] != '"' {
+		err = json.Unmarshal(raw, &value)
+		return value, false, err
+	}
+	var d Duration
+	if err := d.UnmarshalJSON(raw); err != nil {
+		return 0, false, fmt.Errorf("invalid duration %s - %w", string(raw), err)
+	}
+	return int64(d), true, nil
+}
+
+func (r *Rate) UnmarshalJSON(b []byte) error {
+	type rate Rate
+	var raw struct {
+		rate
+		Duration json.RawMessage `json:"duration"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*r = Rate(raw.rate)
+	var err error
+	r.Duration, r.nanos, err = parseRuleDuration(raw.Duration)
+	return err
+}
+
+func (b *Bucket) UnmarshalJSON(data []byte) error {
+	type bucket Bucket
+	var raw struct {
+		bucket
+		Duration json.RawMessage `json:"duration"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*b = Bucket(raw.bucket)
+	var err error
+	b.Duration, b.nanos, err = parseRuleDuration(raw.Duration)
+	return err
+}
+
+func (e *EntityRules) UnmarshalJSON(b []byte) error {
+	type entityRules EntityRules
+	var raw struct {
+		entityRules
+		EntityDuration json.RawMessage `json:"duration,omitempty"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*e = EntityRules(raw.entityRules)
+	var err error
+	e.EntityDuration, e.nanos, err = parseRuleDuration(raw.EntityDuration)
+	return err
+}
+
+// Normalised returns a copy of the import with the durations written as strings converted to unit, the time
+// unit of the namespace. The import itself is left as it is, it is normalised on every import so this only
+// needs to be called to look at the durations beforehand.
+func (i *RuleImport) Normalised(unit time.Duration) (*RuleImport, error) {
+	if i == nil {
+		return nil, nil
+	}
+	normalised := *i
+	var errs ValidationErrors
+	if i.EntityRuleMap != nil {
+		normalised.EntityRuleMap = make(map[string]EntityRules, len(i.EntityRuleMap))
+		for key, entity := range i.EntityRuleMap {
+			normalised.EntityRuleMap[key], errs = entity.normalised(fmt.Sprintf("ruleMap[%s]", key), unit, errs)
+		}
+	}
+	if i.Overrides != nil {
+		normalised.Overrides = make([]EntityRules, len(i.Overrides))
+		for j, override := range i.Overrides {
+			normalised.Overrides[j], errs = override.normalised(fmt.Sprintf("overrides[%d]", j), unit, errs)
+		}
+	}
+	if i.Plans != nil {
+		normalised.Plans = make([]EntityRules, len(i.Plans))
+		for j, plan := range i.Plans {
+			normalised.Plans[j], errs = plan.normalised(fmt.Sprintf("plans[%d]", j), unit, errs)
+		}
+	}
+	if len(errs) > 0 {
+		return &normalised, errs
+	}
+	return &normalised, nil
+}
+
+// normalised copies the attributes and rates of the entity before converting their durations
+func (e EntityRules) normalised(path string, unit time.Duration, errs ValidationErrors) (EntityRules, ValidationErrors) {
+	errs = normaliseDuration(path+".duration", &e.EntityDuration, &e.nanos, unit, errs)
+	e.EntityAttributes = append([]AttributeRule(nil), e.EntityAttributes...)
+	for j := range e.EntityAttributes {
+		attribute := &e.EntityAttributes[j]
+		attributePath := fmt.Sprintf("%s.attributes[%d]", path, j)
+		attribute.Rates = append([]Rate(nil), attribute.Rates...)
+		for k := range attribute.Rates {
+			rate := &attribute.Rates[k]
+			errs = normaliseDuration(fmt.Sprintf("%s.rates[%d].duration", attributePath, k), &rate.Duration, &rate.nanos, unit, errs)
+		}
+		errs = normaliseDuration(attributePath+".bucket.duration", &attribute.Bucket.Duration, &attribute.Bucket.nanos, unit, errs)
+	}
+	return e, errs
+}
+
+func normaliseDuration(path string, duration *int64, nanos *bool, unit time.Duration, errs ValidationErrors) ValidationErrors {
+	if !*nanos {
+		return errs
+	}
+	if *duration%int64(unit) != 0 {
+		return append(errs, ValidationError{
+			Path:    path,
+			Message: fmt.Sprintf("%s is not a whole number of %s", time.Duration(*duration), unit),
+		})
+	}
+	*duration /= int64(unit)
+	*nanos = false
+	return errs
+}
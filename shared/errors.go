@@ -0,0 +1,28 @@
+package structs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError points at a single problem in a rule import, Path follows the JSON
+// layout of the import, e.g. ruleMap[ID].attributes[0].rates[1]
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors holds every problem found in a rule import
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d invalid rule(s) - %s", len(e), strings.Join(messages, "; "))
+}
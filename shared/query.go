@@ -0,0 +1,28 @@
+package structs
+
+import "github.com/pronei/nogo/internal/enums"
+
+// RuleQuery selects rules from the ones in use, every filter that is set has to match
+type RuleQuery struct {
+	EntityType string `json:"entityType,omitempty"`
+	// AttributeType, and AttributeValue along with it, match any of the rule's conditions
+	AttributeType  string         `json:"type,omitempty"`
+	AttributeValue string         `json:"value,omitempty"`
+	Kind           enums.RuleKind `json:"kind,omitempty"`
+	Tag            string         `json:"tag,omitempty"`
+	// Active selects the rules that are, or are not, active at the time of the query
+	Active *bool `json:"active,omitempty"`
+
+	// After is the Next of the previous page, Limit the maximum number of rules on a page, 0 being all of them
+	After string `json:"after,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// RuleQueryResult holds a page of the rules matching a query as an import that recreates them when saved
+type RuleQueryResult struct {
+	Version uint64      `json:"version"`
+	Rules   *RuleImport `json:"rules"`
+	// Total is the number of matching rules across all pages, Next is empty on the last page
+	Total int    `json:"total"`
+	Next  string `json:"next,omitempty"`
+}
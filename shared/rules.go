@@ -1,5 +1,14 @@
 package structs
 
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/helpers"
+)
+
 type LimitRequest struct {
 	//entity name -> attribute name -> attribute value
 	Parameters map[string]EntityParameters `json:"parameters"`
@@ -14,6 +23,42 @@ type EntityParameters struct {
 type RuleImport struct {
 	// key for this map should be the type of entity
 	EntityRuleMap map[string]EntityRules `json:"ruleMap"`
+	Exemptions    []Exemption            `json:"exemptions,omitempty"`
+	Blocks        []Block                `json:"blocks,omitempty"`
+	// Overrides are rules for a single entity, identified by its type and name, that take the place
+	// of the entity type's rules with the same attribute conditions and of its entity limit
+	Overrides []EntityRules `json:"overrides,omitempty"`
+	// Plans are bundles of rules identified by their entity type and name (the plan's name), they apply in the
+	// place of the rules of the entity type like overrides do, to every entity of the type assigned to the plan
+	Plans []EntityRules `json:"plans,omitempty"`
+}
+
+// Exemption lets requests for an entity, by its name or by one of its attributes, through without any limits
+type Exemption struct {
+	Description    string `json:"description,omitempty"`
+	EntityType     string `json:"entityType"`
+	EntityName     string `json:"name,omitempty"`
+	AttributeType  string `json:"type,omitempty"`
+	AttributeValue string `json:"value,omitempty"`
+}
+
+// Block denies every request for an entity by its name, one of its attributes or a pattern on either.
+// Blocks are checked before exemptions and limits, without looking at any state.
+type Block struct {
+	Description    string `json:"description,omitempty"`
+	EntityType     string `json:"entityType"`
+	EntityName     string `json:"name,omitempty"`
+	AttributeType  string `json:"type,omitempty"`
+	AttributeValue string `json:"value,omitempty"`
+	// Pattern is a regular expression the whole entity name, or the attribute's value when type is set, has to match
+	Pattern   string     `json:"pattern,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Reason    string     `json:"reason"`
+}
+
+// ActiveAt is false once the block has expired
+func (b *Block) ActiveAt(t time.Time) bool {
+	return b.ExpiresAt == nil || t.Before(*b.ExpiresAt)
 }
 
 type EntityRules struct {
@@ -21,28 +66,128 @@ type EntityRules struct {
 	EntityType       string          `json:"type"`
 	EntityAttributes []AttributeRule `json:"attributes"`
 
-	// TODO: implement as ALL attribute rule
-	EntityLimit int `json:"limit"`
+	// EntityLimit caps requests for an entity across all of its attributes every EntityDuration,
+	// it is enforced as a rule of its own with a separate state (see constants.EntityLimitAttribute)
+	EntityLimit    int   `json:"limit"`
+	EntityDuration int64 `json:"duration,omitempty"`
+
+	// set when EntityDuration was written as a string, see Rate
+	nanos bool
 }
 
 type AttributeRule struct {
 	Description    string `json:"description,omitempty"`
-	AttributeType  string `json:"type"`
-	AttributeValue string `json:"value"`
+	AttributeType  string `json:"type,omitempty"`
+	AttributeValue string `json:"value,omitempty"`
+
+	// Conditions are matched in conjunction with the type/value pair above (if any),
+	// the rule applies only when every one of them is present in the request
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// Group and Priority only come into play when the namespace evaluates the most specific match,
+	// out of all matching rules in a group the one with the highest priority is enforced
+	Group    string `json:"group,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+
+	// Tags are free-form labels to find rules by, they play no part in evaluation
+	Tags []string `json:"tags,omitempty"`
+
+	// Shadow rules are evaluated and keep their state like any other, but only report when they would
+	// have denied a request instead of denying it
+	Shadow bool `json:"shadow,omitempty"`
+
+	// the rule is only enforced from ActiveFrom and until ActiveUntil, and within the schedule if there is one.
+	// Rules past ActiveUntil are removed from the cache.
+	ActiveFrom  *time.Time `json:"activeFrom,omitempty"`
+	ActiveUntil *time.Time `json:"activeUntil,omitempty"`
+	Schedule    *Schedule  `json:"schedule,omitempty"`
 
 	Rates  []Rate `json:"rates,omitempty"`
 	Bucket Bucket `json:"bucket"`
 }
 
+type Condition struct {
+	AttributeType  string `json:"type"`
+	AttributeValue string `json:"value"`
+}
+
 type Rate struct {
-	// Duration is as specified by the configuration during initialization
+	// Duration is in the time unit of the namespace, it can be written as a Go duration string
+	// like "24h" as well which is converted to the time unit on import (see RuleImport.Normalised)
 	Duration int64 `json:"duration"`
 	Limit    int   `json:"limit"`
+
+	// set when Duration was written as a string and is in nanoseconds until normalised
+	nanos bool
 }
 
 type Bucket struct {
+	// Duration is written like the duration of a rate
 	Duration int64 `json:"duration"`
 	Refill   int64 `json:"refill"`
 	Cost     int64 `json:"cost"`
 	Maximum  int64 `json:"maximum"`
+
+	nanos bool
+}
+
+// MatchConditions returns all the attribute conditions of the rule sorted by attribute type
+func (a *AttributeRule) MatchConditions() []Condition {
+	conditions := make([]Condition, 0, len(a.Conditions)+1)
+	if a.AttributeType != "" {
+		conditions = append(conditions, Condition{AttributeType: a.AttributeType, AttributeValue: a.AttributeValue})
+	}
+	conditions = append(conditions, a.Conditions...)
+	sort.SliceStable(conditions, func(i, j int) bool {
+		return conditions[i].AttributeType < conditions[j].AttributeType
+	})
+	return conditions
+}
+
+// IsCompound is true for rules that match on more than one attribute
+func (a *AttributeRule) IsCompound() bool {
+	return len(a.MatchConditions()) > 1
+}
+
+// Key identifies the rule within its entity type and doubles up as the key for its attribute state.
+// Single condition rules keep the type:value form, compound ones join their sorted conditions.
+// Shadow rules are suffixed so that they can sit next to an enforced rule with the same conditions
+// without either being charged twice for a request.
+func (a *AttributeRule) Key() string {
+	conditions := a.MatchConditions()
+	keys := make([]string, len(conditions))
+	for i, condition := range conditions {
+		keys[i] = helpers.FormKey(condition.AttributeType, condition.AttributeValue)
+	}
+	key := strings.Join(keys, constants.ConditionDelimiter)
+	if a.Shadow {
+		return helpers.FormKey(key, constants.ShadowKey)
+	}
+	return key
+}
+
+// Matches checks if every condition of the rule is satisfied by the attributes passed
+func (a *AttributeRule) Matches(attributes map[string]string) bool {
+	for _, condition := range a.MatchConditions() {
+		if value, exists := attributes[condition.AttributeType]; !exists || value != condition.AttributeValue {
+			return false
+		}
+	}
+	return true
+}
+
+// ActiveAt checks if the rule is to be enforced at t
+func (a *AttributeRule) ActiveAt(t time.Time) bool {
+	if a.ActiveFrom != nil && t.Before(*a.ActiveFrom) {
+		return false
+	}
+	if a.Expired(t) {
+		return false
+	}
+	return a.Schedule == nil || a.Schedule.ActiveAt(t)
+}
+
+// Expired is true once the rule can no longer become active
+func (a *AttributeRule) Expired(t time.Time) bool {
+	return a.ActiveUntil != nil && !t.Before(*a.ActiveUntil)
 }
@@ -0,0 +1,107 @@
+package structs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule limits a rule to recurring windows, e.g. weekdays from 09:00 to 18:00 in Asia/Kolkata.
+// A window that ends before it starts runs past midnight and belongs to the day it started on.
+type Schedule struct {
+	// Days of the week as mon, tue... or all days when empty
+	Days []string `json:"days,omitempty"`
+	// From and Until are times of the day as 15:04, the whole day when both are empty
+	From     string `json:"from,omitempty"`
+	Until    string `json:"until,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+
+	compiled *compiledSchedule
+}
+
+type compiledSchedule struct {
+	days     [7]bool
+	from     int
+	until    int
+	location *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Compile parses the schedule once so that checking it does not have to, it also validates it
+func (s *Schedule) Compile() error {
+	c, err := s.compile()
+	if err != nil {
+		return err
+	}
+	s.compiled = c
+	return nil
+}
+
+func (s *Schedule) compile() (*compiledSchedule, error) {
+	c := &compiledSchedule{location: time.UTC, until: 24 * 60}
+	if s.Timezone != "" {
+		location, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", s.Timezone)
+		}
+		c.location = location
+	}
+	for _, day := range s.Days {
+		weekday, exists := weekdays[strings.ToLower(day)]
+		if !exists {
+			return nil, fmt.Errorf("unknown day %q", day)
+		}
+		c.days[weekday] = true
+	}
+	if len(s.Days) == 0 {
+		c.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	var err error
+	if s.From != "" {
+		if c.from, err = minuteOfDay(s.From); err != nil {
+			return nil, err
+		}
+	}
+	if s.Until != "" {
+		if c.until, err = minuteOfDay(s.Until); err != nil {
+			return nil, err
+		}
+	}
+	if c.from == c.until {
+		return nil, fmt.Errorf("window from %s until %s is empty", s.From, s.Until)
+	}
+	return c, nil
+}
+
+// ActiveAt checks if t falls in one of the schedule's windows
+func (s *Schedule) ActiveAt(t time.Time) bool {
+	c := s.compiled
+	if c == nil {
+		var err error
+		if c, err = s.compile(); err != nil {
+			return false
+		}
+	}
+	local := t.In(c.location)
+	minute := local.Hour()*60 + local.Minute()
+	if c.from < c.until {
+		return c.days[local.Weekday()] && minute >= c.from && minute < c.until
+	}
+	// overnight windows, the early hours belong to the previous day's window
+	if minute >= c.from {
+		return c.days[local.Weekday()]
+	}
+	return minute < c.until && c.days[(local.Weekday()+6)%7]
+}
+
+func minuteOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
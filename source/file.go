@@ -0,0 +1,209 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pronei/nogo/internal/helpers"
+	structs "github.com/pronei/nogo/shared"
+)
+
+type FileOptions struct {
+	// how often the file or directory is checked for changes, defaults to a second
+	PollInterval time.Duration
+	// changes are only picked up once the files have stopped changing for this long, defaults to half a second
+	Debounce time.Duration
+	// Parse turns the contents of a rule file into an import, defaults to Parse which reads
+	// JSON, YAML or TOML depending on the extension of the file
+	Parse func(path string, b []byte) (*structs.RuleImport, error)
+}
+
+// FileSource reloads rules from a file, or from every rule file in a directory, whenever they change.
+// Rule files in a directory are the ones ending in .json, .yaml, .yml or .toml.
+type FileSource struct {
+	tracker
+	path   string
+	opts   FileOptions
+	logger helpers.Logger
+
+	// digest of the contents last applied, rewriting a file as is does not publish a new version
+	digest [sha256.Size]byte
+}
+
+func NewFileSource(logger helpers.Logger, path string, opts FileOptions) *FileSource {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = 500 * time.Millisecond
+	}
+	if opts.Parse == nil {
+		opts.Parse = Parse
+	}
+	return &FileSource{path: path, opts: opts, logger: logger}
+}
+
+// Watch loads the rules once and then keeps watching for changes until the context is done. Failures, the first
+// load's included, are logged and reported through Status while the rules in use are kept, which are the ones the
+// rate limiter was created with until a load succeeds.
+func (w *FileSource) Watch(ctx context.Context, apply ApplyFunc) error {
+	fingerprint, err := w.fingerprint()
+	if err != nil {
+		// the rules are loaded once the files can be read and have settled
+		w.logger.Warn("cannot read rules from %s - %s\n", w.path, err.Error())
+		w.fail(fmt.Errorf("cannot read rules from %s - %w", w.path, err))
+	} else if err := w.reload(apply); err != nil {
+		w.logger.Warn("keeping the rules in use, loading from %s failed - %s\n", w.path, err.Error())
+	}
+
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+
+	var changedAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			latest, err := w.fingerprint()
+			if err != nil {
+				w.logger.Warn("cannot read rules from %s - %s\n", w.path, err.Error())
+				w.fail(err)
+				continue
+			}
+			if latest != fingerprint {
+				fingerprint, changedAt = latest, now
+				continue
+			}
+			// wait for writers to settle before picking the change up
+			if !changedAt.IsZero() && now.Sub(changedAt) >= w.opts.Debounce {
+				changedAt = time.Time{}
+				if err := w.reload(apply); err != nil {
+					w.logger.Warn("keeping rules of version %d, reload from %s failed - %s\n", w.Status().Version, w.path, err.Error())
+				}
+			}
+		}
+	}
+}
+
+// reload parses the rules and applies them as one rule set
+func (w *FileSource) reload(apply ApplyFunc) error {
+	files, err := w.files()
+	if err != nil {
+		return w.fail(err)
+	}
+
+	imported := &structs.RuleImport{EntityRuleMap: make(map[string]structs.EntityRules)}
+	hash := sha256.New()
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return w.fail(fmt.Errorf("cannot read %s - %w", file, err))
+		}
+		hash.Write(b)
+		rules, err := w.opts.Parse(file, b)
+		if err != nil {
+			return w.fail(fmt.Errorf("cannot parse %s - %w", file, err))
+		}
+		if err := merge(imported, rules); err != nil {
+			return w.fail(fmt.Errorf("cannot merge %s - %w", file, err))
+		}
+	}
+
+	var digest [sha256.Size]byte
+	copy(digest[:], hash.Sum(nil))
+	if w.Status().Version > 0 && digest == w.digest {
+		w.unchanged()
+		return nil
+	}
+
+	version, err := apply(imported)
+	if err != nil {
+		return w.fail(err)
+	}
+	w.logger.Info("loaded rules version %d from %s\n", version, w.path)
+	w.digest = digest
+	w.succeed(version)
+	return nil
+}
+
+// files lists the rule files being watched in a stable order
+func (w *FileSource) files() ([]string, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{w.path}, nil
+	}
+	var files []string
+	for _, extension := range ruleFileExtensions {
+		matches, err := filepath.Glob(filepath.Join(w.path, "*"+extension))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// fingerprint summarises the names, sizes and modification times of the rule files
+func (w *FileSource) fingerprint() (string, error) {
+	files, err := w.files()
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s|%d|%d;", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
+
+func parseJSON(_ string, b []byte) (*structs.RuleImport, error) {
+	rules := &structs.RuleImport{}
+	if err := json.Unmarshal(b, rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// merge adds the rules of one file to those read so far, an entity may be spread across files
+// as long as its entity limit is only defined once
+func merge(into, from *structs.RuleImport) error {
+	for key, entity := range from.EntityRuleMap {
+		existing, exists := into.EntityRuleMap[key]
+		if !exists {
+			into.EntityRuleMap[key] = entity
+			continue
+		}
+		if existing.EntityType != entity.EntityType {
+			return fmt.Errorf("entity %s has types %s and %s", key, existing.EntityType, entity.EntityType)
+		}
+		if existing.EntityLimit != 0 && entity.EntityLimit != 0 {
+			return fmt.Errorf("entity limit for %s is defined more than once", key)
+		}
+		if entity.EntityLimit != 0 {
+			existing.EntityLimit, existing.EntityDuration = entity.EntityLimit, entity.EntityDuration
+		}
+		existing.EntityAttributes = append(existing.EntityAttributes, entity.EntityAttributes...)
+		into.EntityRuleMap[key] = existing
+	}
+	into.Exemptions = append(into.Exemptions, from.Exemptions...)
+	into.Blocks = append(into.Blocks, from.Blocks...)
+	into.Overrides = append(into.Overrides, from.Overrides...)
+	into.Plans = append(into.Plans, from.Plans...)
+	return nil
+}
@@ -0,0 +1,176 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	structs "github.com/pronei/nogo/shared"
+)
+
+// recorder applies rule sets by recording which entities they hold, every rule set gets the next version
+type recorder struct {
+	lock    sync.Mutex
+	applied [][]string
+}
+
+func (r *recorder) apply(rules *structs.RuleImport) (uint64, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var entities []string
+	for key := range rules.EntityRuleMap {
+		entities = append(entities, key)
+	}
+	r.applied = append(r.applied, entities)
+	return uint64(len(r.applied)), nil
+}
+
+func (r *recorder) count() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.applied)
+}
+
+func (r *recorder) last() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.applied) == 0 {
+		return nil
+	}
+	return r.applied[len(r.applied)-1]
+}
+
+// watch starts watching the path until the test is over
+func watch(t *testing.T, path string, opts FileOptions) (*FileSource, *recorder) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	w := NewFileSource(nopLogger{}, path, opts)
+	r := &recorder{}
+	go func() {
+		defer close(done)
+		if err := w.Watch(ctx, r.apply); err != nil {
+			t.Errorf("unexpected error - %v", err)
+		}
+	}()
+	return w, r
+}
+
+func writeRules(t *testing.T, path, entity string) {
+	t.Helper()
+	rules := `{"ruleMap": {"` + entity + `": {"type": "user", "attributes": []}}}`
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatalf("cannot write rules - %v", err)
+	}
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFileSourceReloadsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRules(t, path, "first")
+	w, r := watch(t, path, FileOptions{PollInterval: 5 * time.Millisecond, Debounce: 10 * time.Millisecond})
+
+	waitFor(t, "the first load", func() bool { return r.count() == 1 })
+	writeRules(t, path, "second")
+	waitFor(t, "the change to be loaded", func() bool { return w.Status().Version == 2 })
+
+	if last := r.last(); len(last) != 1 || last[0] != "second" {
+		t.Errorf("loaded %v, want the second rules", last)
+	}
+	if status := w.Status(); status.Stale() {
+		t.Errorf("status = %+v, want no error", status)
+	}
+}
+
+func TestFileSourceDebouncesChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRules(t, path, "first")
+	_, r := watch(t, path, FileOptions{PollInterval: 5 * time.Millisecond, Debounce: 200 * time.Millisecond})
+	waitFor(t, "the first load", func() bool { return r.count() == 1 })
+
+	// files that keep changing are not picked up until they settle
+	for _, entity := range []string{"a", "bb", "ccc", "dddd", "eeeee"} {
+		writeRules(t, path, entity)
+		time.Sleep(20 * time.Millisecond)
+		if r.count() != 1 {
+			t.Fatalf("rules were reloaded while the file was still changing")
+		}
+	}
+	waitFor(t, "the settled change to be loaded", func() bool { return r.count() == 2 })
+	time.Sleep(50 * time.Millisecond)
+
+	if count, last := r.count(), r.last(); count != 2 || len(last) != 1 || last[0] != "eeeee" {
+		t.Errorf("loaded %d rule sets ending with %v, want a single reload of the latest rules", count-1, last)
+	}
+}
+
+func TestFileSourceSkipsUnchangedContents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRules(t, path, "first")
+	w, r := watch(t, path, FileOptions{PollInterval: 5 * time.Millisecond, Debounce: 10 * time.Millisecond})
+	waitFor(t, "the first load", func() bool { return w.Status().Version == 1 })
+	loadedAt := w.Status().LastAttempt
+
+	// rewriting the file as is changes its modification time but not its contents
+	writeRules(t, path, "first")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("cannot touch rules - %v", err)
+	}
+	waitFor(t, "the file to be read again", func() bool { return w.Status().LastAttempt.After(loadedAt) })
+
+	if count := r.count(); count != 1 {
+		t.Errorf("applied %d rule sets, want the unchanged rules not to be applied again", count)
+	}
+	if status := w.Status(); status.Version != 1 || status.Stale() {
+		t.Errorf("status = %+v, want version 1 without an error", status)
+	}
+}
+
+func TestFileSourceKeepsWatchingAfterFailedFirstLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, path string)
+	}{
+		{name: "missing file", prepare: func(*testing.T, string) {}},
+		{name: "malformed file", prepare: func(t *testing.T, path string) {
+			if err := os.WriteFile(path, []byte(`{"ruleMap":`), 0o644); err != nil {
+				t.Fatalf("cannot write rules - %v", err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			tt.prepare(t, path)
+			w, r := watch(t, path, FileOptions{PollInterval: 5 * time.Millisecond, Debounce: 10 * time.Millisecond})
+
+			waitFor(t, "the failure to be reported", func() bool { return w.Status().Stale() })
+			if count := r.count(); count != 0 {
+				t.Fatalf("applied %d rule sets from a failed load", count)
+			}
+
+			writeRules(t, path, "fixed")
+			waitFor(t, "the fixed rules to be loaded", func() bool { return r.count() == 1 })
+			waitFor(t, "the failure to be cleared", func() bool { return !w.Status().Stale() })
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package source
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"github.com/pronei/nogo/internal/schema"
+	structs "github.com/pronei/nogo/shared"
+	"gopkg.in/yaml.v3"
+)
+
+// Extensions of the rule files read by Parse
+var ruleFileExtensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// Parse reads a rule file as YAML, TOML or JSON depending on its extension, JSON being the default.
+// Errors in the shape of a YAML or TOML document point at its line and column. The rules are validated
+// once they are applied, those errors are structs.ValidationErrors with paths into the import and are not
+// mapped back to lines of the file.
+func Parse(path string, b []byte) (*structs.RuleImport, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseYAML(b)
+	case ".toml":
+		return ParseTOML(b)
+	default:
+		return parseJSON(path, b)
+	}
+}
+
+// position in a YAML or TOML document
+type position struct {
+	line   int
+	column int
+}
+
+// documentError points at the line and column of the document the error was found at
+type documentError struct {
+	position
+	err error
+}
+
+func (e *documentError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.line, e.column, e.err.Error())
+}
+
+func (e *documentError) Unwrap() error {
+	return e.err
+}
+
+// ParseYAML reads rules written in YAML, which take the same shape as in JSON
+func ParseYAML(b []byte) (*structs.RuleImport, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(b, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return &structs.RuleImport{}, nil
+	}
+	positions := make(map[string]position)
+	value, err := yamlValue(document.Content[0], "", positions)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDocument(value, positions)
+}
+
+func yamlValue(node *yaml.Node, path string, positions map[string]position) (any, error) {
+	positions[path] = position{line: node.Line, column: node.Column}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		return yamlValue(node.Content[0], path, positions)
+	case yaml.AliasNode:
+		return yamlValue(node.Alias, path, positions)
+	case yaml.MappingNode:
+		object := make(map[string]any, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, valueNode := node.Content[i], node.Content[i+1]
+			keyPath := joinPath(path, key.Value)
+			value, err := yamlValue(valueNode, keyPath, positions)
+			if err != nil {
+				return nil, err
+			}
+			// the key points at where the field starts rather than at its value
+			positions[keyPath] = position{line: key.Line, column: key.Column}
+			object[key.Value] = value
+		}
+		return object, nil
+	case yaml.SequenceNode:
+		array := make([]any, len(node.Content))
+		for i, item := range node.Content {
+			value, err := yamlValue(item, fmt.Sprintf("%s[%d]", path, i), positions)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = value
+		}
+		return array, nil
+	default:
+		var value any
+		switch node.ShortTag() {
+		case "!!str":
+			value = node.Value
+		case "!!null":
+			value = nil
+		default:
+			if err := node.Decode(&value); err != nil {
+				return nil, &documentError{position{node.Line, node.Column}, err}
+			}
+		}
+		return value, nil
+	}
+}
+
+// ParseTOML reads rules written in TOML, which take the same shape as in JSON
+func ParseTOML(b []byte) (*structs.RuleImport, error) {
+	var value map[string]any
+	if err := toml.Unmarshal(b, &value); err != nil {
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			line, column := decodeErr.Position()
+			return nil, &documentError{position{line, column}, err}
+		}
+		return nil, err
+	}
+	return decodeDocument(value, tomlPositions(b))
+}
+
+// tomlPositions finds where each key of a TOML document is defined, arrays of tables are counted
+// so that their keys get the same paths as the values decoded from them
+func tomlPositions(b []byte) map[string]position {
+	positions := make(map[string]position)
+	tables := make(map[string]int)
+	parser := unstable.Parser{}
+	parser.Reset(b)
+
+	var keyPositions func(node *unstable.Node, prefix string)
+	keyPath := func(node *unstable.Node, prefix string) string {
+		path := prefix
+		key := node.Key()
+		for key.Next() {
+			part := key.Node()
+			path = joinPath(path, string(part.Data))
+			// the last element of an array of tables is the one being defined
+			if count, exists := tables[path]; exists && !key.IsLast() {
+				path = fmt.Sprintf("%s[%d]", path, count-1)
+			}
+			shape := parser.Shape(part.Raw)
+			if _, exists := positions[path]; !exists {
+				positions[path] = position{line: shape.Start.Line, column: shape.Start.Column}
+			}
+		}
+		return path
+	}
+	keyPositions = func(node *unstable.Node, prefix string) {
+		switch node.Kind {
+		case unstable.InlineTable:
+			children := node.Children()
+			for children.Next() {
+				keyPositions(children.Node(), prefix)
+			}
+		case unstable.Array:
+			children := node.Children()
+			for i := 0; children.Next(); i++ {
+				keyPositions(children.Node(), fmt.Sprintf("%s[%d]", prefix, i))
+			}
+		case unstable.KeyValue:
+			keyPositions(node.Value(), keyPath(node, prefix))
+		}
+	}
+
+	prefix := ""
+	for parser.NextExpression() {
+		expression := parser.Expression()
+		switch expression.Kind {
+		case unstable.Table:
+			prefix = keyPath(expression, "")
+		case unstable.ArrayTable:
+			path := keyPath(expression, "")
+			prefix = fmt.Sprintf("%s[%d]", path, tables[path])
+			tables[path]++
+			shape := parser.Shape(expression.Child().Raw)
+			positions[prefix] = position{line: shape.Start.Line, column: shape.Start.Column}
+		case unstable.KeyValue:
+			keyPositions(expression, prefix)
+		}
+	}
+	return positions
+}
+
+// decodeDocument checks a decoded document against the shape of structs.RuleImport and converts it,
+// so that mistakes are reported where they were made, before it is read like a JSON rule file
+func decodeDocument(document any, positions map[string]position) (*structs.RuleImport, error) {
+	d := &documentDecoder{positions: positions}
+	value, err := d.convert(document, reflect.TypeOf(structs.RuleImport{}), "", false)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	rules := &structs.RuleImport{}
+	if err := json.Unmarshal(b, rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+type documentDecoder struct {
+	positions map[string]position
+}
+
+// errorAt reports an error at the path, or at the closest parent of it that has a known position
+func (d *documentDecoder) errorAt(path string, format string, args ...any) error {
+	err := fmt.Errorf(format, args...)
+	if path != "" {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	for {
+		if pos, exists := d.positions[path]; exists {
+			return &documentError{pos, err}
+		}
+		if path == "" {
+			return err
+		}
+		path = parentPath(path)
+	}
+}
+
+// convert turns a decoded value into what the JSON form of t expects
+func (d *documentDecoder) convert(value any, t reflect.Type, path string, duration bool) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case duration:
+		switch v := value.(type) {
+		case string:
+			if _, err := time.ParseDuration(v); err != nil {
+				return nil, d.errorAt(path, "invalid duration %q, expected an integer or a duration such as \"1m\" or \"24h\"", v)
+			}
+			return v, nil
+		default:
+			return d.integer(value, path)
+		}
+	case t == reflect.TypeOf(time.Time{}):
+		switch v := value.(type) {
+		case time.Time:
+			return v, nil
+		case toml.LocalDateTime, toml.LocalDate:
+			return nil, d.errorAt(path, "time %v needs a timezone offset", v)
+		case string:
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				return nil, d.errorAt(path, "invalid time %q, expected RFC 3339 such as 2024-06-01T00:00:00Z", v)
+			}
+			return v, nil
+		}
+		return nil, d.errorAt(path, "expected a time, got %s", describe(value))
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, d.errorAt(path, "expected an object, got %s", describe(value))
+		}
+		fields := make(map[string]schema.Field)
+		for _, field := range schema.Fields(t) {
+			fields[field.Name] = field
+		}
+		converted := make(map[string]any, len(object))
+		for _, key := range sortedFields(object) {
+			field, exists := fields[key]
+			if !exists {
+				return nil, d.errorAt(joinPath(path, key), "unknown field %q", key)
+			}
+			fieldValue, err := d.convert(object[key], field.Type, joinPath(path, key), field.Duration)
+			if err != nil {
+				return nil, err
+			}
+			converted[key] = fieldValue
+		}
+		return converted, nil
+	case reflect.Map:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, d.errorAt(path, "expected an object, got %s", describe(value))
+		}
+		converted := make(map[string]any, len(object))
+		for _, key := range sortedFields(object) {
+			entry, err := d.convert(object[key], t.Elem(), joinPath(path, key), false)
+			if err != nil {
+				return nil, err
+			}
+			converted[key] = entry
+		}
+		return converted, nil
+	case reflect.Slice:
+		array, ok := value.([]any)
+		if !ok {
+			return nil, d.errorAt(path, "expected a list, got %s", describe(value))
+		}
+		converted := make([]any, len(array))
+		for i, item := range array {
+			entry, err := d.convert(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), false)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = entry
+		}
+		return converted, nil
+	case reflect.String:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case bool, int, int64, uint64, float64:
+			// unquoted attribute values such as 100 are meant as text
+			return fmt.Sprint(v), nil
+		}
+		return nil, d.errorAt(path, "expected a string, got %s", describe(value))
+	case reflect.Bool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+		return nil, d.errorAt(path, "expected true or false, got %s", describe(value))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return d.integer(value, path)
+	default:
+		return value, nil
+	}
+}
+
+func (d *documentDecoder) integer(value any, path string) (any, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return v, nil
+	case uint64:
+		if v <= math.MaxInt64 {
+			return v, nil
+		}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt64 {
+			return int64(v), nil
+		}
+	}
+	return nil, d.errorAt(path, "expected an integer, got %s", describe(value))
+}
+
+func describe(value any) string {
+	switch v := value.(type) {
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "a list"
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func sortedFields(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// parentPath drops the last key or index of a path
+func parentPath(path string) string {
+	cut := strings.LastIndexAny(path, ".[")
+	if cut < 0 {
+		return ""
+	}
+	return path[:cut]
+}
@@ -0,0 +1,229 @@
+package source
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/pronei/nogo/internal/constants"
+	"github.com/pronei/nogo/internal/enums"
+	"github.com/pronei/nogo/internal/validation"
+	structs "github.com/pronei/nogo/shared"
+)
+
+const jsonRules = `{
+    "ruleMap": {
+        "ID": {
+            "type": "ID",
+            "limit": 100,
+            "duration": "1h",
+            "attributes": [
+                {
+                    "description": "free users",
+                    "type": "user_tier",
+                    "value": "free",
+                    "tags": ["tier"],
+                    "rates": [{"duration": "1m", "limit": 10}, {"duration": 86400, "limit": 1000}]
+                },
+                {
+                    "conditions": [{"type": "region", "value": "eu"}, {"type": "port", "value": "100"}],
+                    "group": "eu",
+                    "priority": 2,
+                    "shadow": true,
+                    "rates": [{"duration": "1m", "limit": 5}]
+                }
+            ]
+        }
+    },
+    "overrides": [
+        {"type": "ID", "name": "12345", "attributes": [{"type": "user_tier", "value": "free", "rates": [{"duration": "1m", "limit": 50}]}]}
+    ],
+    "exemptions": [{"entityType": "ID", "name": "admin"}]
+}`
+
+const yamlRules = `
+ruleMap:
+  ID:
+    type: ID
+    limit: 100
+    duration: 1h
+    attributes:
+      - description: free users
+        type: user_tier
+        value: free
+        tags: [tier]
+        rates:
+          - duration: 1m
+            limit: 10
+          - duration: 86400
+            limit: 1000
+      - conditions:
+          - type: region
+            value: eu
+          - type: port
+            value: 100
+        group: eu
+        priority: 2
+        shadow: true
+        rates:
+          - duration: 1m
+            limit: 5
+overrides:
+  - type: ID
+    name: "12345"
+    attributes:
+      - type: user_tier
+        value: free
+        rates:
+          - duration: 1m
+            limit: 50
+exemptions:
+  - entityType: ID
+    name: admin
+`
+
+const tomlRules = `
+[ruleMap.ID]
+type = "ID"
+limit = 100
+duration = "1h"
+
+[[ruleMap.ID.attributes]]
+description = "free users"
+type = "user_tier"
+value = "free"
+tags = ["tier"]
+rates = [{ duration = "1m", limit = 10 }, { duration = 86400, limit = 1000 }]
+
+[[ruleMap.ID.attributes]]
+conditions = [{ type = "region", value = "eu" }, { type = "port", value = 100 }]
+group = "eu"
+priority = 2
+shadow = true
+
+[[ruleMap.ID.attributes.rates]]
+duration = "1m"
+limit = 5
+
+[[overrides]]
+type = "ID"
+name = "12345"
+
+[[overrides.attributes]]
+type = "user_tier"
+value = "free"
+rates = [{ duration = "1m", limit = 50 }]
+
+[[exemptions]]
+entityType = "ID"
+name = "admin"
+`
+
+func TestParseFormatsAgree(t *testing.T) {
+	want, err := Parse("rules.json", []byte(jsonRules))
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	for _, path := range []string{"rules.yaml", "rules.yml", "rules.toml"} {
+		t.Run(path, func(t *testing.T) {
+			document := yamlRules
+			if path == "rules.toml" {
+				document = tomlRules
+			}
+			got, err := Parse(path, []byte(document))
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Parse(%s) = %+v, want %+v as read from JSON", path, got, want)
+			}
+		})
+	}
+}
+
+func TestParseReportsShapeErrorsWhereTheyAre(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		document string
+		want     string
+	}{
+		{
+			name: "unknown field in YAML",
+			path: "rules.yaml",
+			document: `ruleMap:
+  ID:
+    type: ID
+    attributes:
+      - type: user_tier
+        rate: 10
+`,
+			want: `line 6, column 9: ruleMap.ID.attributes[0].rate: unknown field "rate"`,
+		},
+		{
+			name: "invalid duration in YAML",
+			path: "rules.yaml",
+			document: `ruleMap:
+  ID:
+    type: ID
+    attributes:
+      - type: user_tier
+        rates:
+          - duration: 1 minute
+            limit: 10
+`,
+			want: `line 7, column 13: ruleMap.ID.attributes[0].rates[0].duration: invalid duration "1 minute", expected an integer or a duration such as "1m" or "24h"`,
+		},
+		{
+			name: "list instead of an object in TOML",
+			path: "rules.toml",
+			document: `[ruleMap.ID]
+type = "ID"
+
+[[ruleMap.ID.attributes]]
+type = "user_tier"
+bucket = [1, 2]
+`,
+			want: `line 6, column 1: ruleMap.ID.attributes[0].bucket: expected an object, got a list`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.path, []byte(tt.document))
+			var documentErr *documentError
+			if !errors.As(err, &documentErr) {
+				t.Fatalf("want an error with a line and column, got %v", err)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("error = %q, want %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+// validation errors are found in the parsed rules, they point at the rule in the import rather than the document
+func TestParseLeavesValidationToTheImport(t *testing.T) {
+	document := `ruleMap:
+  ID:
+    type: ID
+    attributes:
+      - type: user_tier
+        value: free
+        rates:
+          - duration: 1m
+            limit: -1
+`
+	rules, err := Parse("rules.yaml", []byte(document))
+	if err != nil {
+		t.Fatalf("well-formed rules failed to parse - %v", err)
+	}
+
+	err = validation.Rules(rules, enums.RuleAdd, &structs.StrategyConfig{Type: "rolling_window", TimeUnit: constants.Second})
+	var errs structs.ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("want a single validation error, got %v", err)
+	}
+	if errs[0].Path != "ruleMap[ID].attributes[0].rates[0].limit" {
+		t.Errorf("validation error is at %s, want the path of the limit in the import", errs[0].Path)
+	}
+}
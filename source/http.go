@@ -0,0 +1,131 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pronei/nogo/internal/helpers"
+	structs "github.com/pronei/nogo/shared"
+)
+
+type HTTPOptions struct {
+	// Client used for polling, defaults to one with a 10 second timeout
+	Client *http.Client
+	// how often the endpoint is polled while it is healthy, defaults to 30 seconds
+	Interval time.Duration
+	// upper bound for the exponential backoff applied on consecutive failures, defaults to 5 minutes
+	MaxBackoff time.Duration
+	// Header is sent along with every poll, e.g. for authorization
+	Header http.Header
+}
+
+// HTTPSource polls an endpoint serving a RuleImport document. Conditional requests are made with
+// the ETag of the last rules applied, so an unchanged document costs a 304 and nothing else.
+type HTTPSource struct {
+	tracker
+	url    string
+	opts   HTTPOptions
+	logger helpers.Logger
+
+	etag     string
+	failures int
+}
+
+func NewHTTPSource(logger helpers.Logger, url string, opts HTTPOptions) *HTTPSource {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+	return &HTTPSource{url: url, opts: opts, logger: logger}
+}
+
+// Watch polls until the context is done, failures are retried with backoff and reported through Status
+func (h *HTTPSource) Watch(ctx context.Context, apply ApplyFunc) error {
+	for {
+		err := h.poll(ctx, apply)
+		switch {
+		case ctx.Err() != nil:
+			// a poll cut short by shutting down is not a failure of the endpoint
+			return nil
+		case err != nil:
+			h.failures++
+			h.logger.Warn("polling rules from %s failed (attempt %d) - %s\n", h.url, h.failures, err.Error())
+		default:
+			h.failures = 0
+		}
+
+		timer := time.NewTimer(h.wait())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// wait doubles the polling interval for every consecutive failure
+func (h *HTTPSource) wait() time.Duration {
+	wait := h.opts.Interval
+	for i := 0; i < h.failures && wait < h.opts.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, h.opts.MaxBackoff)
+}
+
+func (h *HTTPSource) poll(ctx context.Context, apply ApplyFunc) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return h.fail(fmt.Errorf("cannot build request - %w", err))
+	}
+	for key, values := range h.opts.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+	if h.etag != "" {
+		req.Header.Set("If-None-Match", h.etag)
+	}
+
+	resp, err := h.opts.Client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return h.fail(fmt.Errorf("request failed - %w", err))
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		h.unchanged()
+		return nil
+	case resp.StatusCode != http.StatusOK:
+		io.Copy(io.Discard, resp.Body)
+		return h.fail(fmt.Errorf("unexpected status %s", resp.Status))
+	}
+
+	rules := &structs.RuleImport{}
+	if err := json.NewDecoder(resp.Body).Decode(rules); err != nil {
+		return h.fail(fmt.Errorf("cannot parse rules - %w", err))
+	}
+	version, err := apply(rules)
+	if err != nil {
+		// the ETag is only remembered for applied rules so a rejected document is fetched again
+		return h.fail(err)
+	}
+	h.etag = resp.Header.Get("ETag")
+	h.logger.Info("loaded rules version %d from %s\n", version, h.url)
+	h.succeed(version)
+	return nil
+}
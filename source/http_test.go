@@ -0,0 +1,119 @@
+package source
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	structs "github.com/pronei/nogo/shared"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(...any)  {}
+func (nopLogger) Debug(...any) {}
+func (nopLogger) Error(...any) {}
+func (nopLogger) Warn(...any)  {}
+func (nopLogger) Fatal(...any) {}
+func (nopLogger) Panic(...any) {}
+
+func TestHTTPSourcePoll(t *testing.T) {
+	const etag = `"v1"`
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		ifNoneMatch string
+		wantApplied bool
+		wantErr     bool
+	}{
+		{name: "rules are applied", status: http.StatusOK, body: `{"ruleMap":{}}`, wantApplied: true},
+		{name: "unchanged rules are not applied again", status: http.StatusOK, body: `{"ruleMap":{}}`, ifNoneMatch: etag},
+		{name: "error status", status: http.StatusInternalServerError, wantErr: true},
+		{name: "malformed rules", status: http.StatusOK, body: `{"ruleMap":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-Token") != "secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if r.Header.Get("If-None-Match") == etag {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", etag)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			h := NewHTTPSource(nopLogger{}, server.URL, HTTPOptions{Header: http.Header{"X-Token": {"secret"}}})
+			h.etag = tt.ifNoneMatch
+			applied := false
+			err := h.poll(context.Background(), func(*structs.RuleImport) (uint64, error) {
+				applied = true
+				return 7, nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("poll error = %v, want error %v", err, tt.wantErr)
+			}
+			if applied != tt.wantApplied {
+				t.Errorf("applied = %v, want %v", applied, tt.wantApplied)
+			}
+			if h.Status().Stale() != tt.wantErr {
+				t.Errorf("stale = %v, want %v", h.Status().Stale(), tt.wantErr)
+			}
+			if tt.wantApplied && (h.etag != etag || h.Status().Version != 7) {
+				t.Errorf("etag = %s, version = %d after applying, want %s and 7", h.etag, h.Status().Version, etag)
+			}
+		})
+	}
+}
+
+func TestHTTPSourceBackoff(t *testing.T) {
+	h := NewHTTPSource(nopLogger{}, "", HTTPOptions{Interval: time.Second, MaxBackoff: 5 * time.Second})
+	for failures, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		h.failures = failures
+		if got := h.wait(); got != want {
+			t.Errorf("wait after %d failures = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestHTTPSourceShutdownIsNotAFailure(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	h := NewHTTPSource(nopLogger{}, server.URL, HTTPOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- h.Watch(ctx, func(*structs.RuleImport) (uint64, error) { return 1, nil })
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("watch returned %v on shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not return after the context was cancelled")
+	}
+	if h.failures != 0 || h.Status().Stale() {
+		t.Errorf("shutdown counted as a failure, failures = %d, last error = %v", h.failures, h.Status().LastError)
+	}
+}
@@ -0,0 +1,67 @@
+package source
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	structs "github.com/pronei/nogo/shared"
+)
+
+// RuleSource delivers complete rule sets from somewhere outside the process
+type RuleSource interface {
+	// Watch blocks until the context is done, passing every new rule set to apply which returns the
+	// version they were published as. On error the rules were rejected and the last good ones stay in use.
+	Watch(ctx context.Context, apply ApplyFunc) error
+	Status() Status
+}
+
+type ApplyFunc func(*structs.RuleImport) (uint64, error)
+
+// Status of a source, while LastError is set the rules of Version are still being served
+type Status struct {
+	Version     uint64    `json:"version"`
+	LastLoaded  time.Time `json:"lastLoaded"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	LastError   error     `json:"-"`
+}
+
+// Stale is true when the latest rules could not be fetched or applied
+func (s Status) Stale() bool {
+	return s.LastError != nil
+}
+
+// tracker keeps the status of a source safe for concurrent reads
+type tracker struct {
+	lock   sync.Mutex
+	status Status
+}
+
+func (t *tracker) Status() Status {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.status
+}
+
+func (t *tracker) succeed(version uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := time.Now()
+	t.status = Status{Version: version, LastLoaded: now, LastAttempt: now}
+}
+
+// unchanged records a successful check that found nothing new
+func (t *tracker) unchanged() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.status.LastAttempt = time.Now()
+	t.status.LastError = nil
+}
+
+func (t *tracker) fail(err error) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.status.LastAttempt = time.Now()
+	t.status.LastError = err
+	return err
+}